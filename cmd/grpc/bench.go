@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	benchFormatText = "text"
+	benchFormatJSON = "json"
+)
+
+// benchDefaultCalls is the number of calls bench makes if neither --calls nor
+// --duration is given.
+const benchDefaultCalls = 200
+
+// benchHistogramBuckets is the number of buckets in bench's latency histogram.
+const benchHistogramBuckets = 10
+
+// benchMethod repeatedly calls a method, and reports on its performance. ctx
+// shouldn't have any headers yet; bench adds them, so that with --template-vars
+// it can expand them again for each call.
+func benchMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, args args) error {
+	if len(args.Symbols) != 1 {
+		return fmt.Errorf("bench: must be given exactly one method")
+	}
+
+	switch args.BenchFormat {
+	case "", benchFormatText, benchFormatJSON:
+	default:
+		return fmt.Errorf("--bench-format: must be %q or %q, got: %q", benchFormatText, benchFormatJSON, args.BenchFormat)
+	}
+
+	if args.Calls < 0 || args.Duration < 0 || args.QPS < 0 || args.Concurrency < 0 {
+		return fmt.Errorf("bench: --calls, --duration, --qps, and --concurrency must not be negative")
+	}
+
+	method, err := msrc.Method(protoreflect.FullName(args.Symbols[0]))
+	if err != nil {
+		return err
+	}
+
+	_, ctxRPC, err := args.metadataContexts(ctx)
+	if err != nil {
+		return err
+	}
+
+	// read all inputs up front, so that reading doesn't affect latencies
+	render, err := benchInputs(ctxRPC, method, args)
+	if err != nil {
+		return err
+	}
+
+	inputs, err := render()
+	if err != nil {
+		return err
+	}
+
+	if len(inputs) == 0 {
+		return fmt.Errorf("bench: no input messages")
+	}
+
+	b := benchmark{cc: cc, method: method, inputs: inputs, calls: int64(args.Calls), concurrency: args.Concurrency}
+	if args.TemplateVars {
+		b.render = render
+		b.headers = func(ctx context.Context) (context.Context, error) {
+			_, ctxRPC, err := args.metadataContexts(ctx)
+			return ctxRPC, err
+		}
+	} else {
+		ctx = ctxRPC
+	}
+
+	if args.Duration > 0 {
+		b.deadline = time.Now().Add(seconds(args.Duration))
+	} else if b.calls == 0 {
+		b.calls = benchDefaultCalls
+	}
+
+	if args.QPS > 0 {
+		b.interval = time.Duration(float64(time.Second) / args.QPS)
+	}
+
+	if b.concurrency == 0 {
+		b.concurrency = 1
+	}
+
+	report := b.run(ctx)
+	if b.renderErr != nil {
+		return b.renderErr
+	}
+
+	if args.BenchFormat == benchFormatJSON {
+		out, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("marshal bench report: %w", err)
+		}
+
+		out, err = args.formatJSON(out)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(out))
+		return nil
+	}
+
+	report.writeText(os.Stdout)
+	return nil
+}
+
+// benchInputs returns a function that reads bench's input messages. Usually,
+// input is read once, and the function returns the same messages every time.
+// With --template-vars, the function expands templates again each time, so
+// that e.g. each call gets its own {{uuid}}.
+func benchInputs(ctx context.Context, method protoreflect.MethodDescriptor, args args) (func() ([]proto.Message, error), error) {
+	if !args.TemplateVars {
+		var inputs []proto.Message
+		if err := readInput(ctx, method, args, func(msg proto.Message) error {
+			inputs = append(inputs, msg)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		return func() ([]proto.Message, error) { return inputs, nil }, nil
+	}
+
+	// stdin can only be read once, so keep the raw input around
+	type source struct {
+		name string
+		raw  []byte
+	}
+
+	var sources []source
+	for _, d := range args.inputData(method) {
+		r, name, err := openData(d)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			return nil, dataError(name, err)
+		}
+
+		sources = append(sources, source{name: name, raw: raw})
+	}
+
+	return func() ([]proto.Message, error) {
+		if sources == nil {
+			// the input can be left out; see inputData
+			return []proto.Message{dynamicpb.NewMessage(method.Input())}, nil
+		}
+
+		var inputs []proto.Message
+		for _, s := range sources {
+			if err := readMessages(ctx, method, args, bytes.NewReader(s.raw), func(msg proto.Message) error {
+				inputs = append(inputs, msg)
+				return nil
+			}); err != nil {
+				return nil, dataError(s.name, err)
+			}
+		}
+
+		return inputs, nil
+	}, nil
+}
+
+type benchmark struct {
+	cc          *grpc.ClientConn
+	method      protoreflect.MethodDescriptor
+	inputs      []proto.Message
+	concurrency int
+
+	// render, if not nil, returns fresh inputs for each call; see benchInputs
+	render func() ([]proto.Message, error)
+
+	// headers, if not nil, returns ctx with freshly expanded headers for each
+	// call; otherwise, the headers are already in the context given to run
+	headers func(ctx context.Context) (context.Context, error)
+
+	// renderErr is the error from render or headers that stopped the
+	// benchmark, if any
+	renderErr error
+
+	// cancel stops the benchmark early
+	cancel context.CancelFunc
+
+	// calls is the number of calls to make, or zero if there's no limit
+	calls int64
+
+	// deadline is when to stop making calls, or the zero time if there's no
+	// time limit
+	deadline time.Time
+
+	// interval is the time between the start of consecutive calls, or zero if
+	// calls aren't rate-limited
+	interval time.Duration
+
+	// next is the index of the next call to make
+	next int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	codes     map[codes.Code]int
+}
+
+func (b *benchmark) run(ctx context.Context) benchReport {
+	b.codes = map[codes.Code]int{}
+
+	ctx, b.cancel = context.WithCancel(ctx)
+	defer b.cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < b.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.work(ctx, start)
+		}()
+	}
+
+	wg.Wait()
+
+	// calls still in flight at the deadline are waited for, but the run
+	// itself only lasted until the deadline
+	end := time.Now()
+	if !b.deadline.IsZero() && end.After(b.deadline) {
+		end = b.deadline
+	}
+
+	return newBenchReport(end.Sub(start), b.latencies, b.codes)
+}
+
+// work makes calls until there are no more to make.
+func (b *benchmark) work(ctx context.Context, start time.Time) {
+	for {
+		i := atomic.AddInt64(&b.next, 1) - 1
+		if b.calls > 0 && i >= b.calls {
+			return
+		}
+
+		// with a rate limit, call i is scheduled for a fixed time after start,
+		// so that falling behind doesn't lower the overall rate
+		if b.interval > 0 {
+			scheduled := start.Add(time.Duration(i) * b.interval)
+			if !b.deadline.IsZero() && scheduled.After(b.deadline) {
+				// no point waiting for a slot after --duration is up
+				return
+			}
+
+			timer := time.NewTimer(time.Until(scheduled))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+
+		if ctx.Err() != nil || (!b.deadline.IsZero() && time.Now().After(b.deadline)) {
+			return
+		}
+
+		in, err := b.input(i)
+		if err != nil {
+			b.stop(err)
+			return
+		}
+
+		callCtx := ctx
+		if b.headers != nil {
+			callCtx, err = b.headers(ctx)
+			if err != nil {
+				b.stop(err)
+				return
+			}
+		}
+
+		callStart := time.Now()
+		err = b.call(callCtx, in)
+		latency := time.Since(callStart)
+
+		b.mu.Lock()
+		b.latencies = append(b.latencies, latency)
+		b.codes[status.Code(err)]++
+		b.mu.Unlock()
+	}
+}
+
+// stop stops the benchmark early because of err.
+func (b *benchmark) stop(err error) {
+	b.mu.Lock()
+	if b.renderErr == nil {
+		b.renderErr = err
+	}
+	b.mu.Unlock()
+
+	b.cancel()
+}
+
+// input returns the input message for call i, cycling through the inputs.
+func (b *benchmark) input(i int64) (proto.Message, error) {
+	inputs := b.inputs
+	if b.render != nil {
+		var err error
+		inputs, err = b.render()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return inputs[i%int64(len(inputs))], nil
+}
+
+// call makes a single call, sending in as its only input message and
+// discarding its output.
+func (b *benchmark) call(ctx context.Context, in proto.Message) error {
+	streamDesc := grpc.StreamDesc{
+		ServerStreams: b.method.IsStreamingServer(),
+		ClientStreams: b.method.IsStreamingClient(),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := b.cc.NewStream(ctx, &streamDesc, methodInvokeName(string(b.method.FullName())))
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(in); err != nil && err != io.EOF {
+		return err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	for {
+		if err := stream.RecvMsg(dynamicpb.NewMessage(b.method.Output())); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// benchReport is the output of bench. Durations are in seconds.
+type benchReport struct {
+	Calls       int            `json:"calls"`
+	Errors      int            `json:"errors"`
+	Duration    float64        `json:"duration"`
+	Throughput  float64        `json:"throughput"`
+	Latency     benchLatency   `json:"latency"`
+	Histogram   []benchBucket  `json:"histogram"`
+	StatusCodes map[string]int `json:"statusCodes"`
+	codes       map[codes.Code]int
+}
+
+type benchLatency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// benchBucket is a histogram bucket, counting calls with latencies no greater
+// than UpTo, and greater than the previous bucket's UpTo.
+type benchBucket struct {
+	UpTo  float64 `json:"upTo"`
+	Count int     `json:"count"`
+}
+
+func newBenchReport(elapsed time.Duration, latencies []time.Duration, statusCodes map[codes.Code]int) benchReport {
+	r := benchReport{
+		Calls:       len(latencies),
+		Duration:    elapsed.Seconds(),
+		Throughput:  float64(len(latencies)) / elapsed.Seconds(),
+		Histogram:   []benchBucket{},
+		StatusCodes: map[string]int{},
+		codes:       statusCodes,
+	}
+
+	for code, n := range statusCodes {
+		r.StatusCodes[code.String()] = n
+		if code != codes.OK {
+			r.Errors += n
+		}
+	}
+
+	if len(latencies) == 0 {
+		return r
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+
+	min, max := latencies[0], latencies[len(latencies)-1]
+	r.Latency = benchLatency{
+		Min:  min.Seconds(),
+		Mean: (total / time.Duration(len(latencies))).Seconds(),
+		P50:  percentile(latencies, 50).Seconds(),
+		P90:  percentile(latencies, 90).Seconds(),
+		P99:  percentile(latencies, 99).Seconds(),
+		Max:  max.Seconds(),
+	}
+
+	// evenly-sized buckets from min to max
+	width := (max - min) / benchHistogramBuckets
+	if width == 0 {
+		return r
+	}
+
+	i := 0
+	for b := 1; b <= benchHistogramBuckets; b++ {
+		upTo := min + time.Duration(b)*width
+		if b == benchHistogramBuckets {
+			upTo = max
+		}
+
+		bucket := benchBucket{UpTo: upTo.Seconds()}
+		for ; i < len(latencies) && latencies[i] <= upTo; i++ {
+			bucket.Count++
+		}
+
+		r.Histogram = append(r.Histogram, bucket)
+	}
+
+	return r
+}
+
+// percentile returns the p-th percentile of sorted, using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func (r benchReport) writeText(w io.Writer) {
+	_, _ = fmt.Fprintf(w, "Calls:       %d (%d errors)\n", r.Calls, r.Errors)
+	_, _ = fmt.Fprintf(w, "Duration:    %v\n", benchDuration(r.Duration))
+	_, _ = fmt.Fprintf(w, "Throughput:  %.2f calls/s\n", r.Throughput)
+
+	if r.Calls == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "\nLatency:\n")
+	for _, l := range []struct {
+		name  string
+		value float64
+	}{
+		{"min", r.Latency.Min},
+		{"mean", r.Latency.Mean},
+		{"p50", r.Latency.P50},
+		{"p90", r.Latency.P90},
+		{"p99", r.Latency.P99},
+		{"max", r.Latency.Max},
+	} {
+		_, _ = fmt.Fprintf(w, "  %-5s %v\n", l.name, benchDuration(l.value))
+	}
+
+	if len(r.Histogram) > 0 {
+		most := 0
+		for _, b := range r.Histogram {
+			if b.Count > most {
+				most = b.Count
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "\nHistogram:\n")
+		for _, b := range r.Histogram {
+			line := fmt.Sprintf("  %-12v %-6d %s", benchDuration(b.UpTo), b.Count, strings.Repeat("∎", b.Count*40/most))
+			_, _ = fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+	}
+
+	var statusCodes []codes.Code
+	for code := range r.codes {
+		statusCodes = append(statusCodes, code)
+	}
+
+	sort.Slice(statusCodes, func(i, j int) bool { return statusCodes[i] < statusCodes[j] })
+
+	_, _ = fmt.Fprintf(w, "\nStatus codes:\n")
+	for _, code := range statusCodes {
+		_, _ = fmt.Fprintf(w, "  %-19v %d\n", code, r.codes[code])
+	}
+}
+
+// benchDuration converts seconds back into a time.Duration, for formatting.
+func benchDuration(s float64) time.Duration {
+	return seconds(s).Round(time.Microsecond)
+}
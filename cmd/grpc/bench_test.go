@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestBenchTemplateHeaders(t *testing.T) {
+	// calls never reach a server; the interceptor just records their headers
+	var mu sync.Mutex
+	var ids []string
+	intercept := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+
+		mu.Lock()
+		ids = append(ids, md.Get("x-request-id")...)
+		mu.Unlock()
+
+		return nil, status.Error(codes.Unavailable, "not really calling")
+	}
+
+	cc, err := grpc.NewClient("passthrough:///bench", grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithStreamInterceptor(intercept))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+
+	defer cc.Close()
+
+	msrc, err := newProtosetMethodSource([]string{"../../internal/echo/echo.protoset"})
+	if err != nil {
+		t.Fatalf("newProtosetMethodSource: %v", err)
+	}
+
+	defer msrc.Close()
+
+	args := args{
+		Method:       "bench",
+		Symbols:      []string{"echo.Echo.Echo"},
+		Data:         []string{`{"message": "hi"}`},
+		Header:       []string{"x-request-id: {{uuid}}"},
+		TemplateVars: true,
+		Calls:        2,
+		BenchFormat:  benchFormatJSON,
+	}
+
+	if err := benchMethod(context.Background(), cc, msrc, args); err != nil {
+		t.Fatalf("benchMethod: %v", err)
+	}
+
+	if len(ids) != 2 {
+		t.Fatalf("got %d x-request-id headers, want 2: %q", len(ids), ids)
+	}
+
+	if ids[0] == ids[1] {
+		t.Errorf("both calls got the same x-request-id: %q", ids[0])
+	}
+
+	if ids[0] == "{{uuid}}" || ids[1] == "{{uuid}}" {
+		t.Errorf("x-request-id was not expanded: %q", ids)
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defaultCacheTTL is how long cached descriptors are used for, unless
+// --cache-ttl says otherwise.
+const defaultCacheTTL = 10 * time.Minute
+
+// descriptorCacheRetention is how long cached descriptors are kept for before
+// they're removed. Other invocations may use a longer --cache-ttl than this
+// one, so this is independent of it, unless this one's is longer still.
+const descriptorCacheRetention = 24 * time.Hour
+
+// cachedMethodSource serves descriptors from a cache of everything a server
+// exposes via reflection. Anything missing from the cache, e.g. because the
+// server has changed since, is looked up via reflection instead.
+type cachedMethodSource struct {
+	reg *protoregistry.Files
+
+	// services are the services the server listed, in the order it listed
+	// them; the cached files may well declare others
+	services []protoreflect.ServiceDescriptor
+
+	// reflect opens a reflection method source, which is only done if needed
+	reflect  func() (methodSource, error)
+	fallback methodSource
+}
+
+// newCachedMethodSource returns a method source that uses the descriptor cache
+// for the target, if it's fresh. Otherwise, it fetches every descriptor via
+// reflection, and updates the cache.
+func newCachedMethodSource(ctx context.Context, args args, cc *grpc.ClientConn) (methodSource, error) {
+	if err := validateReflectVersion(args.ReflectVersion); err != nil {
+		return nil, err
+	}
+
+	open := func() (methodSource, error) {
+		r, err := newReflectMethodSource(ctx, args, cc)
+		if err != nil {
+			return nil, err
+		}
+
+		return r, nil
+	}
+
+	path, err := descriptorCachePath(args)
+	if err != nil {
+		// without a cache directory, there can be no cache
+		return open()
+	}
+
+	var log *verboseLogger
+	if args.Verbose {
+		log = &verboseLogger{w: os.Stderr}
+	}
+
+	ttl := defaultCacheTTL
+	if args.CacheTTL > 0 {
+		ttl = seconds(args.CacheTTL)
+	}
+
+	if !args.RefreshCache {
+		if fds, services, ok := readDescriptorCache(path, ttl); ok {
+			c, err := newCachedMethodSourceFromSet(fds, services)
+			if err == nil {
+				if log != nil {
+					log.printf("*", "using cached descriptors from %s", path)
+				}
+
+				c.reflect = open
+				return c, nil
+			}
+		}
+	}
+
+	r, err := newReflectMethodSource(ctx, args, cc)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := r.Methods()
+	if err != nil {
+		// some servers can't list their services, but can still describe
+		// individual symbols, so carry on without a cache
+		return r, nil
+	}
+
+	fds := descriptorCacheSet(r.files)
+	services := listedServices(methods)
+	if err := writeDescriptorCache(path, fds, services); err != nil {
+		if log != nil {
+			log.printf("*", "could not write descriptor cache: %v", err)
+		}
+	} else if log != nil {
+		log.printf("*", "wrote descriptor cache to %s", path)
+	}
+
+	retention := descriptorCacheRetention
+	if ttl > retention {
+		retention = ttl
+	}
+
+	pruneDescriptorCache(filepath.Dir(path), retention)
+
+	c, err := newCachedMethodSourceFromSet(fds, services)
+	if err != nil {
+		return nil, err
+	}
+
+	c.fallback = r
+	return c, nil
+}
+
+func newCachedMethodSourceFromSet(fds *descriptorpb.FileDescriptorSet, services []protoreflect.FullName) (*cachedMethodSource, error) {
+	reg, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("create file registry: %w", err)
+	}
+
+	c := &cachedMethodSource{reg: reg}
+	for _, name := range services {
+		d, err := reg.FindDescriptorByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("find service %s: %w", name, err)
+		}
+
+		svc, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
+
+		c.services = append(c.services, svc)
+	}
+
+	return c, nil
+}
+
+func (c *cachedMethodSource) Methods() ([]protoreflect.MethodDescriptor, error) {
+	var mds []protoreflect.MethodDescriptor
+	for _, svc := range c.services {
+		methods := svc.Methods()
+		for i, l := 0, methods.Len(); i < l; i++ {
+			mds = append(mds, methods.Get(i))
+		}
+	}
+
+	return mds, nil
+}
+
+func (c *cachedMethodSource) Method(name protoreflect.FullName) (protoreflect.MethodDescriptor, error) {
+	d, err := c.Descriptor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+
+	return md, nil
+}
+
+func (c *cachedMethodSource) Descriptor(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := c.reg.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+
+	if c.fallback == nil {
+		var err error
+		c.fallback, err = c.reflect()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.fallback.Descriptor(name)
+}
+
+func (c *cachedMethodSource) Extension(message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error) {
+	if xd, err := findExtension(c.reg, message, number); err == nil {
+		return xd, nil
+	}
+
+	// extensions are often declared in files that no service depends on, so
+	// the cache may well not have them
+	if c.fallback == nil {
+		var err error
+		c.fallback, err = c.reflect()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.fallback.Extension(message, number)
+}
+
+func (c *cachedMethodSource) loadedFile(path string) *descriptorpb.FileDescriptorProto {
+	if fd, err := c.reg.FindFileByPath(path); err == nil {
+		return protodesc.ToFileDescriptorProto(fd)
+	}
+
+	if loaded, ok := c.fallback.(loadedFileSource); ok {
+		return loaded.loadedFile(path)
+	}
+
+	return nil
+}
+
+func (c *cachedMethodSource) Close() error {
+	if c.fallback != nil {
+		return c.fallback.Close()
+	}
+
+	return nil
+}
+
+// descriptorCacheSet returns the files in files, sorted by name, so that the
+// cache is the same each time the server is the same.
+func descriptorCacheSet(files map[string]*descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorSet {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var fds descriptorpb.FileDescriptorSet
+	for _, name := range names {
+		fds.File = append(fds.File, files[name])
+	}
+
+	return &fds
+}
+
+// listedServices returns the services of methods, which are as the server
+// listed them, in the same order.
+func listedServices(methods []protoreflect.MethodDescriptor) []protoreflect.FullName {
+	var services []protoreflect.FullName
+	seen := map[protoreflect.FullName]bool{}
+	for _, m := range methods {
+		name := m.Parent().FullName()
+		if !seen[name] {
+			seen[name] = true
+			services = append(services, name)
+		}
+	}
+
+	return services
+}
+
+// descriptorCacheName matches the characters of a target that are safe to use
+// in a file name.
+var descriptorCacheName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// descriptorCachePath returns where descriptors for the target are cached.
+// Servers can return different descriptors depending on headers, e.g. for
+// different tenants, so the path depends on the headers sent on reflection
+// RPCs, as well as the target itself. The headers are used as given, before
+// any --template-vars are expanded, so that e.g. a fresh token each time
+// doesn't mean a fresh cache each time.
+func descriptorCachePath(args args) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	target, _ := parseTarget(args.Target, args.targetAliases)
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n", target, args.ReflectVersion)
+	for _, headers := range [][]string{args.Header, args.HeaderRawKey, args.HeaderRawValue, args.ReflectHeader, args.ReflectHeaderRawKey, args.ReflectHeaderRawValue} {
+		_, _ = fmt.Fprintf(h, "%q\n", headers)
+	}
+
+	name := strings.Trim(descriptorCacheName.ReplaceAllString(target, "_"), "_")
+	return filepath.Join(dir, "grpcake", "descriptors", name+"-"+hex.EncodeToString(h.Sum(nil))[:16]+".protoset"), nil
+}
+
+// descriptorCacheServicesPath returns where the names of the services listed
+// by the target are cached, given the path of its cached descriptors. The
+// cached files alone don't say which of the services they declare the server
+// actually exposes.
+func descriptorCacheServicesPath(path string) string {
+	return strings.TrimSuffix(path, ".protoset") + ".services"
+}
+
+// readDescriptorCache returns the descriptors and service names cached at path,
+// if they were cached less than ttl ago.
+func readDescriptorCache(path string, ttl time.Duration) (*descriptorpb.FileDescriptorSet, []protoreflect.FullName, bool) {
+	b, ok := readDescriptorCacheFile(path, ttl)
+	if !ok {
+		return nil, nil, false
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &fds); err != nil {
+		return nil, nil, false
+	}
+
+	b, ok = readDescriptorCacheFile(descriptorCacheServicesPath(path), ttl)
+	if !ok {
+		return nil, nil, false
+	}
+
+	var services []protoreflect.FullName
+	for _, name := range strings.Fields(string(b)) {
+		services = append(services, protoreflect.FullName(name))
+	}
+
+	return &fds, services, true
+}
+
+func readDescriptorCacheFile(path string, ttl time.Duration) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > ttl {
+		return nil, false
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	return b, true
+}
+
+// writeDescriptorCache writes fds to path, as a .protoset file, and services
+// next to it, one per line.
+func writeDescriptorCache(path string, fds *descriptorpb.FileDescriptorSet, services []protoreflect.FullName) error {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(fds)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	if err := writeDescriptorCacheFile(path, b); err != nil {
+		return err
+	}
+
+	var names strings.Builder
+	for _, name := range services {
+		names.WriteString(string(name) + "\n")
+	}
+
+	return writeDescriptorCacheFile(descriptorCacheServicesPath(path), []byte(names.String()))
+}
+
+// writeDescriptorCacheFile writes b to path. The file is replaced atomically,
+// so that concurrent invocations never see a partial file.
+func writeDescriptorCacheFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// pruneDescriptorCache removes files in dir older than retention, so that the
+// cache doesn't grow forever as targets and headers come and go. It's
+// best-effort; anything it can't remove is left for next time.
+func pruneDescriptorCache(dir string, retention time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) <= retention {
+			continue
+		}
+
+		_ = os.Remove(filepath.Join(dir, e.Name()))
+	}
+}
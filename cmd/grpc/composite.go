@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// reflectModeAuto uses reflection only if there are no --protoset or
+	// --proto files.
+	reflectModeAuto = "auto"
+
+	// reflectModeFirst uses reflection, and then --protoset or --proto files
+	// for anything reflection doesn't have.
+	reflectModeFirst = "first"
+
+	// reflectModeLast uses --protoset or --proto files, and then reflection
+	// for anything they don't have.
+	reflectModeLast = "last"
+)
+
+func validateReflectMode(mode string) error {
+	switch mode {
+	case "", reflectModeAuto, reflectModeFirst, reflectModeLast:
+		return nil
+	default:
+		return fmt.Errorf("--reflect: must be one of %q, %q, or %q, got: %q", reflectModeAuto, reflectModeFirst, reflectModeLast, mode)
+	}
+}
+
+// loadedFileSource is implemented by method sources that can look up files
+// they've already loaded, without any round trips to the server.
+type loadedFileSource interface {
+	loadedFile(path string) *descriptorpb.FileDescriptorProto
+}
+
+// compositeMethodSource looks up descriptors in each of its sources in turn,
+// using the first that has them.
+type compositeMethodSource struct {
+	sources []methodSource
+
+	// names describe each of sources in diagnostics
+	names []string
+
+	// warn is where diagnostics about conflicting files are written, and
+	// warned are the files they've been written about
+	warn   io.Writer
+	warned map[string]bool
+}
+
+func newCompositeMethodSource(warn io.Writer) *compositeMethodSource {
+	return &compositeMethodSource{warn: warn, warned: map[string]bool{}}
+}
+
+func (c *compositeMethodSource) add(name string, msrc methodSource) {
+	c.sources = append(c.sources, msrc)
+	c.names = append(c.names, name)
+}
+
+func (c *compositeMethodSource) Methods() ([]protoreflect.MethodDescriptor, error) {
+	// every source is loaded before checking for conflicts, so that files
+	// from earlier sources can be compared against later ones
+	all := make([][]protoreflect.MethodDescriptor, len(c.sources))
+	for i, msrc := range c.sources {
+		mds, err := msrc.Methods()
+		if err != nil {
+			return nil, err
+		}
+
+		all[i] = mds
+	}
+
+	var mds []protoreflect.MethodDescriptor
+	seen := map[protoreflect.FullName]bool{}
+	for i, sourceMethods := range all {
+		for _, m := range sourceMethods {
+			if seen[m.FullName()] {
+				continue
+			}
+
+			seen[m.FullName()] = true
+			c.checkFile(i, m.ParentFile())
+			mds = append(mds, m)
+		}
+	}
+
+	return mds, nil
+}
+
+func (c *compositeMethodSource) Method(name protoreflect.FullName) (protoreflect.MethodDescriptor, error) {
+	d, err := c.Descriptor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+
+	return md, nil
+}
+
+func (c *compositeMethodSource) Descriptor(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	var errs []error
+	for i, msrc := range c.sources {
+		d, err := msrc.Descriptor(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		c.checkFile(i, d.ParentFile())
+		return d, nil
+	}
+
+	return nil, firstInterestingError(errs)
+}
+
+func (c *compositeMethodSource) Extension(message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error) {
+	var errs []error
+	for i, msrc := range c.sources {
+		xd, err := msrc.Extension(message, number)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		c.checkFile(i, xd.ParentFile())
+		return xd, nil
+	}
+
+	return nil, firstInterestingError(errs)
+}
+
+func (c *compositeMethodSource) Close() error {
+	var errs []error
+	for _, msrc := range c.sources {
+		if err := msrc.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// firstInterestingError returns the first of errs, from each source in turn,
+// that isn't protoregistry.NotFound. A source simply not having something is
+// the least interesting way for it to fail, so anything else, like a
+// connection error, is reported instead if there is one.
+func firstInterestingError(errs []error) error {
+	for _, err := range errs {
+		if !errors.Is(err, protoregistry.NotFound) {
+			return err
+		}
+	}
+
+	return errs[0]
+}
+
+// checkFile warns if fd, which is being used from source i, is defined
+// differently by any other source that has loaded a file of the same name.
+// Types from fd won't be the same as the other source's, so messages encoded
+// with one definition may not decode with the other.
+func (c *compositeMethodSource) checkFile(i int, fd protoreflect.FileDescriptor) {
+	if c.warned[fd.Path()] {
+		return
+	}
+
+	var used *descriptorpb.FileDescriptorProto
+	for j, msrc := range c.sources {
+		loaded, ok := msrc.(loadedFileSource)
+		if j == i || !ok {
+			continue
+		}
+
+		other := loaded.loadedFile(fd.Path())
+		if other == nil {
+			continue
+		}
+
+		if used == nil {
+			used = protodesc.ToFileDescriptorProto(fd)
+		}
+
+		if !sameFile(used, other) {
+			c.warned[fd.Path()] = true
+			_, _ = fmt.Fprintf(c.warn, "warning: %s from %s differs from %s from %s; using the one from %s\n", fd.Path(), c.names[i], fd.Path(), c.names[j], c.names[i])
+			return
+		}
+	}
+}
+
+// sameFile returns whether a and b define the same things. Source info, such
+// as comments, and the order things are declared in are ignored, so that files
+// regenerated by export match the originals.
+func sameFile(a, b *descriptorpb.FileDescriptorProto) bool {
+	a = proto.Clone(a).(*descriptorpb.FileDescriptorProto)
+	b = proto.Clone(b).(*descriptorpb.FileDescriptorProto)
+	for _, f := range []*descriptorpb.FileDescriptorProto{a, b} {
+		f.SourceCodeInfo = nil
+		sortMessages(f.MessageType)
+		sortEnums(f.EnumType)
+		sortExtensions(f.Extension)
+		sort.SliceStable(f.Service, func(i, j int) bool {
+			return f.Service[i].GetName() < f.Service[j].GetName()
+		})
+	}
+
+	return proto.Equal(a, b)
+}
+
+func sortMessages(msgs []*descriptorpb.DescriptorProto) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].GetName() < msgs[j].GetName()
+	})
+
+	for _, m := range msgs {
+		sortMessages(m.NestedType)
+		sortEnums(m.EnumType)
+		sortExtensions(m.Extension)
+	}
+}
+
+func sortEnums(enums []*descriptorpb.EnumDescriptorProto) {
+	sort.SliceStable(enums, func(i, j int) bool {
+		return enums[i].GetName() < enums[j].GetName()
+	})
+}
+
+func sortExtensions(exts []*descriptorpb.FieldDescriptorProto) {
+	sort.SliceStable(exts, func(i, j int) bool {
+		return exts[i].GetName() < exts[j].GetName()
+	})
+}
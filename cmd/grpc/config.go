@@ -0,0 +1,304 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// config is the contents of the config file.
+type config struct {
+	// Aliases maps target aliases to the targets they stand for.
+	Aliases map[string]string `toml:"aliases"`
+
+	// Profiles are named sets of defaults for flags.
+	Profiles map[string]map[string]interface{} `toml:"profiles"`
+
+	// path is where the config file was loaded from
+	path string
+}
+
+// configProfileTargets is the profile setting listing which targets (or
+// aliases) use the profile by default. Every other setting is a flag.
+const configProfileTargets = "targets"
+
+// configPathValues are the "value" tags of flags that take file paths, which
+// are relative to the config file when they appear in a profile.
+var configPathValues = map[string]bool{"file": true, "dir": true, "ca-cert": true, "cert-file": true, "key-file": true}
+
+// resolvePath returns path, from a profile in cfg, relative to the config file
+// rather than the working directory.
+func (cfg config) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(cfg.path), path)
+}
+
+// defaultConfigPath returns where the config file is, unless --config says
+// otherwise.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "grpcake", "config.toml"), nil
+}
+
+func loadConfig(path string) (config, error) {
+	cfg := config{path: path}
+	if _, err := toml.DecodeFile(path, &cfg); err != nil {
+		return config{}, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	for alias, target := range cfg.Aliases {
+		if target == "" {
+			return config{}, fmt.Errorf("config %s: alias %q: target must not be empty", path, alias)
+		}
+	}
+
+	return cfg, nil
+}
+
+// applyConfig loads the config file, and applies the profile chosen by
+// --profile, or else by TARGET, if any. Flags given on the command line take
+// precedence over the profile.
+func (args *args) applyConfig() error {
+	path := args.Config
+	if path == "" {
+		var err error
+		path, err = defaultConfigPath()
+		if err != nil {
+			// with no config directory, there can be no config file
+			if args.Profile != "" {
+				return fmt.Errorf("--profile: %w", err)
+			}
+
+			return nil
+		}
+	}
+
+	cfg, err := loadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) && args.Config == "" && args.Profile == "" {
+		// the config file is optional
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	args.targetAliases = cfg.Aliases
+
+	name := args.Profile
+	if name == "" {
+		name, err = cfg.profileForTarget(args.Target)
+		if err != nil {
+			return err
+		}
+
+		if name == "" {
+			return nil
+		}
+	}
+
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return fmt.Errorf("--profile: no profile named %q in %s", name, path)
+	}
+
+	if err := args.applyProfile(cfg, profile); err != nil {
+		return fmt.Errorf("config %s: profile %q: %w", path, name, err)
+	}
+
+	args.profile = name
+	args.profilePath = path
+	return nil
+}
+
+// profileForTarget returns the name of the profile whose targets include
+// target, either as given or after resolving aliases, or "" if there is none.
+func (cfg config) profileForTarget(target string) (string, error) {
+	resolved, _ := parseTarget(target, cfg.Aliases)
+
+	var names []string
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var matches []string
+	for _, name := range names {
+		targets, err := configStrings(cfg.Profiles[name][configProfileTargets])
+		if err != nil {
+			return "", fmt.Errorf("config %s: profile %q: %s: %w", cfg.path, name, configProfileTargets, err)
+		}
+
+		for _, t := range targets {
+			if t == target || t == resolved {
+				matches = append(matches, name)
+				break
+			}
+		}
+	}
+
+	if len(matches) > 1 {
+		return "", fmt.Errorf("config %s: target %q is in multiple profiles (%s); choose one with --profile", cfg.path, target, strings.Join(matches, ", "))
+	}
+
+	if len(matches) == 0 {
+		return "", nil
+	}
+
+	return matches[0], nil
+}
+
+// applyProfile sets flags from profile, which maps long flag names (without
+// the leading "--") to values. Flags already given on the command line are
+// left alone, except for headers, which are added to the profile's headers.
+func (args *args) applyProfile(cfg config, profile map[string]interface{}) error {
+	var keys []string
+	for k := range profile {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	v := reflect.ValueOf(args).Elem()
+	t := v.Type()
+	for _, key := range keys {
+		if key == configProfileTargets {
+			continue
+		}
+
+		if key == "config" || key == "profile" {
+			return fmt.Errorf("%s: can only be given on the command line", key)
+		}
+
+		i := flagFieldIndex(t, key)
+		if i == -1 {
+			return fmt.Errorf("unknown setting %q; settings are the names of flags, like \"server-name\"", key)
+		}
+
+		field := v.Field(i)
+		value := profile[key]
+		switch field.Kind() {
+		case reflect.String:
+			s, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s: must be a string", key)
+			}
+
+			if configPathValues[t.Field(i).Tag.Get("value")] {
+				s = cfg.resolvePath(s)
+			}
+
+			if field.String() == "" {
+				field.SetString(s)
+			}
+		case reflect.Bool:
+			b, ok := value.(bool)
+			if !ok {
+				return fmt.Errorf("%s: must be a boolean", key)
+			}
+
+			if !field.Bool() {
+				field.SetBool(b)
+			}
+		case reflect.Int:
+			n, ok := value.(int64)
+			if !ok {
+				return fmt.Errorf("%s: must be an integer", key)
+			}
+
+			if field.Int() == 0 {
+				field.SetInt(n)
+			}
+		case reflect.Float64:
+			var f float64
+			switch value := value.(type) {
+			case int64:
+				f = float64(value)
+			case float64:
+				f = value
+			default:
+				return fmt.Errorf("%s: must be a number", key)
+			}
+
+			if field.Float() == 0 {
+				field.SetFloat(f)
+			}
+		case reflect.Slice:
+			ss, err := configStrings(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+
+			if configPathValues[t.Field(i).Tag.Get("value")] {
+				for j, s := range ss {
+					ss[j] = cfg.resolvePath(s)
+				}
+			}
+
+			cli := field.Interface().([]string)
+			switch {
+			case strings.Contains(key, "header"):
+				field.Set(reflect.ValueOf(append(ss, cli...)))
+			case len(cli) == 0:
+				field.Set(reflect.ValueOf(ss))
+			}
+		default:
+			return fmt.Errorf("%s: not supported in profiles", key)
+		}
+	}
+
+	return nil
+}
+
+// flagFieldIndex returns the index of the field of t for the flag with the
+// given long name, or -1 if there is no such flag.
+func flagFieldIndex(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		for _, part := range strings.Split(t.Field(i).Tag.Get("cli"), ",") {
+			if part == "--"+name {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// configStrings converts a TOML string or array of strings into a slice.
+func configStrings(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		var out []string
+		for _, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be an array of strings")
+			}
+
+			out = append(out, s)
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
 
 var (
 	connErrEarlyClose      = `rpc error: code = Unavailable desc = connection closed before server preface received`
@@ -9,7 +16,7 @@ var (
 
 func humanizeConnErr(args args, err error) error {
 	if err.Error() == connErrEarlyClose {
-		if _, shorthand := parseTarget(args.Target); shorthand || args.Insecure {
+		if _, shorthand := parseTarget(args.Target, args.targetAliases); shorthand || args.Insecure {
 			return fmt.Errorf("%w (is the server expecting TLS?)", err)
 		} else {
 			return fmt.Errorf("%w (is the server expecting mutual TLS?)", err)
@@ -20,5 +27,11 @@ func humanizeConnErr(args args, err error) error {
 		return fmt.Errorf("%w (is the server expecting plaintext?)", err)
 	}
 
+	// blocking dials fail with the context's error, rather than a status
+	deadlineExceeded := status.Code(err) == codes.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded)
+	if deadlineExceeded && args.MaxTime > 0 {
+		return fmt.Errorf("%w (operation did not complete within --max-time)", err)
+	}
+
 	return err
 }
@@ -0,0 +1,651 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxFieldNumber is the largest valid field number, which .proto syntax calls
+// "max" in reserved and extension ranges.
+const maxFieldNumber = 536870911
+
+// fileSyntaxField is the number of FileDescriptorProto's syntax field, which
+// source info uses to locate comments on the syntax statement.
+const fileSyntaxField = 12
+
+func describeSymbols(msrc methodSource, args args) error {
+	var descs []protoreflect.Descriptor
+	if len(args.Symbols) == 0 {
+		// with no symbol, describe every service
+		methods, err := msrc.Methods()
+		if err != nil {
+			return err
+		}
+
+		seen := map[protoreflect.FullName]bool{}
+		for _, m := range methods {
+			svc := m.Parent().(protoreflect.ServiceDescriptor)
+			if !seen[svc.FullName()] {
+				seen[svc.FullName()] = true
+				descs = append(descs, svc)
+			}
+		}
+	}
+
+	for _, s := range args.Symbols {
+		d, err := msrc.Descriptor(protoreflect.FullName(s))
+		if err != nil {
+			return err
+		}
+
+		descs = append(descs, d)
+	}
+
+	for i, d := range descs {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Print(describeDescriptor(d))
+	}
+
+	return nil
+}
+
+// describeDescriptor returns d rendered as .proto source.
+func describeDescriptor(d protoreflect.Descriptor) string {
+	var p protoPrinter
+	switch d := d.(type) {
+	case protoreflect.ServiceDescriptor:
+		p.service(d)
+	case protoreflect.MethodDescriptor:
+		p.method(d)
+	case protoreflect.MessageDescriptor:
+		p.message(d)
+	case protoreflect.FieldDescriptor:
+		if d.IsExtension() {
+			p.extend(d.ContainingMessage(), []protoreflect.FieldDescriptor{d})
+		} else {
+			p.field(d)
+		}
+	case protoreflect.OneofDescriptor:
+		p.oneof(d)
+	case protoreflect.EnumDescriptor:
+		p.enum(d)
+	case protoreflect.EnumValueDescriptor:
+		p.enumValue(d)
+	}
+
+	return p.b.String()
+}
+
+// describeFile returns fd rendered as a whole .proto source file.
+func describeFile(fd protoreflect.FileDescriptor) string {
+	var p protoPrinter
+
+	// comments before the syntax statement are usually license headers
+	syntaxLoc := fd.SourceLocations().ByPath(protoreflect.SourcePath{fileSyntaxField})
+	for _, c := range syntaxLoc.LeadingDetachedComments {
+		p.comment(c)
+		p.b.WriteString("\n")
+	}
+
+	p.comment(syntaxLoc.LeadingComments)
+	switch fd.Syntax() {
+	case protoreflect.Editions:
+		edition := protodesc.ToFileDescriptorProto(fd).GetEdition()
+		p.printf("edition = %q;", strings.TrimPrefix(edition.String(), "EDITION_"))
+	default:
+		p.printf("syntax = %q;", fd.Syntax())
+	}
+
+	if fd.Package() != "" {
+		p.b.WriteString("\n")
+		p.printf("package %s;", fd.Package())
+	}
+
+	imports := fd.Imports()
+	if imports.Len() > 0 {
+		p.b.WriteString("\n")
+	}
+
+	for i, l := 0, imports.Len(); i < l; i++ {
+		imp := imports.Get(i)
+		var modifier string
+		switch {
+		case imp.IsPublic:
+			modifier = "public "
+		case imp.IsWeak:
+			modifier = "weak "
+		}
+
+		p.printf("import %s%q;", modifier, imp.Path())
+	}
+
+	if opts := optionEntries(fd.Options()); len(opts) > 0 {
+		p.b.WriteString("\n")
+		p.options(fd.Options())
+	}
+
+	services := fd.Services()
+	for i, l := 0, services.Len(); i < l; i++ {
+		p.b.WriteString("\n")
+		p.service(services.Get(i))
+	}
+
+	msgs := fd.Messages()
+	for i, l := 0, msgs.Len(); i < l; i++ {
+		// groups are printed along with their fields instead
+		if isGroupMessage(msgs.Get(i)) {
+			continue
+		}
+
+		p.b.WriteString("\n")
+		p.message(msgs.Get(i))
+	}
+
+	enums := fd.Enums()
+	for i, l := 0, enums.Len(); i < l; i++ {
+		p.b.WriteString("\n")
+		p.enum(enums.Get(i))
+	}
+
+	for _, exts := range groupExtensions(fd.Extensions()) {
+		p.b.WriteString("\n")
+		p.extend(exts[0].ContainingMessage(), exts)
+	}
+
+	return p.b.String()
+}
+
+type protoPrinter struct {
+	b     strings.Builder
+	depth int
+}
+
+func (p *protoPrinter) printf(format string, a ...interface{}) {
+	p.b.WriteString(strings.Repeat("  ", p.depth))
+	fmt.Fprintf(&p.b, format, a...)
+	p.b.WriteString("\n")
+}
+
+func (p *protoPrinter) open(format string, a ...interface{}) {
+	p.printf(format+" {", a...)
+	p.depth++
+}
+
+func (p *protoPrinter) close() {
+	p.depth--
+	p.printf("}")
+}
+
+// leadingComments prints d's leading comments from source info, if any.
+func (p *protoPrinter) leadingComments(d protoreflect.Descriptor) {
+	loc := d.ParentFile().SourceLocations().ByDescriptor(d)
+	for _, c := range loc.LeadingDetachedComments {
+		p.comment(c)
+		p.b.WriteString("\n")
+	}
+
+	p.comment(loc.LeadingComments)
+}
+
+// decl prints a single-line declaration of d, followed by d's trailing
+// comments from source info, if any. Single-line trailing comments stay on the
+// same line as the declaration, like they usually are in .proto source.
+func (p *protoPrinter) decl(d protoreflect.Descriptor, format string, a ...interface{}) {
+	trailing := strings.TrimSuffix(d.ParentFile().SourceLocations().ByDescriptor(d).TrailingComments, "\n")
+	if trailing != "" && !strings.Contains(trailing, "\n") {
+		p.printf(format+" //%s", append(a, trailing)...)
+		return
+	}
+
+	p.printf(format, a...)
+	p.comment(trailing)
+}
+
+func (p *protoPrinter) comment(c string) {
+	if c == "" {
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(c, "\n"), "\n") {
+		p.printf("//%s", line)
+	}
+}
+
+func (p *protoPrinter) options(opts proto.Message) {
+	for _, o := range optionEntries(opts) {
+		p.printf("option %s;", o)
+	}
+}
+
+func (p *protoPrinter) service(sd protoreflect.ServiceDescriptor) {
+	p.leadingComments(sd)
+	p.open("service %s", sd.Name())
+	p.options(sd.Options())
+
+	methods := sd.Methods()
+	for i, l := 0, methods.Len(); i < l; i++ {
+		p.method(methods.Get(i))
+	}
+
+	p.close()
+}
+
+func (p *protoPrinter) method(md protoreflect.MethodDescriptor) {
+	var streamClient string
+	if md.IsStreamingClient() {
+		streamClient = "stream "
+	}
+
+	var streamServer string
+	if md.IsStreamingServer() {
+		streamServer = "stream "
+	}
+
+	p.leadingComments(md)
+
+	sig := fmt.Sprintf("rpc %s(%s%s) returns (%s%s)", md.Name(), streamClient, qualifiedName(md.Input()), streamServer, qualifiedName(md.Output()))
+	if opts := optionEntries(md.Options()); len(opts) > 0 {
+		p.open("%s", sig)
+		for _, o := range opts {
+			p.printf("option %s;", o)
+		}
+		p.close()
+	} else {
+		p.decl(md, "%s;", sig)
+	}
+}
+
+func (p *protoPrinter) message(md protoreflect.MessageDescriptor) {
+	p.leadingComments(md)
+	p.open("message %s", md.Name())
+	p.messageBody(md)
+	p.close()
+}
+
+// messageBody prints what's between the braces of md's declaration, which is
+// shared by messages and groups.
+func (p *protoPrinter) messageBody(md protoreflect.MessageDescriptor) {
+	p.options(md.Options())
+
+	fields := md.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		fd := fields.Get(i)
+
+		// print each oneof where its first field would have been
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() {
+			if od.Fields().Get(0) == fd {
+				p.oneof(od)
+			}
+
+			continue
+		}
+
+		p.field(fd)
+	}
+
+	p.reserved(md.ReservedRanges(), md.ReservedNames())
+
+	extRanges := md.ExtensionRanges()
+	for i, l := 0, extRanges.Len(); i < l; i++ {
+		r := extRanges.Get(i)
+		p.printf("extensions %s;", formatRange(r[0], r[1]-1))
+	}
+
+	enums := md.Enums()
+	for i, l := 0, enums.Len(); i < l; i++ {
+		p.enum(enums.Get(i))
+	}
+
+	msgs := md.Messages()
+	for i, l := 0, msgs.Len(); i < l; i++ {
+		// map entries are printed as map<K, V> fields instead, and groups
+		// along with their fields
+		if !msgs.Get(i).IsMapEntry() && !isGroupMessage(msgs.Get(i)) {
+			p.message(msgs.Get(i))
+		}
+	}
+
+	for _, exts := range groupExtensions(md.Extensions()) {
+		p.extend(exts[0].ContainingMessage(), exts)
+	}
+}
+
+func (p *protoPrinter) reserved(ranges protoreflect.FieldRanges, names protoreflect.Names) {
+	if ranges.Len() > 0 {
+		var rs []string
+		for i, l := 0, ranges.Len(); i < l; i++ {
+			r := ranges.Get(i)
+			rs = append(rs, formatRange(r[0], r[1]-1))
+		}
+
+		p.printf("reserved %s;", strings.Join(rs, ", "))
+	}
+
+	if names.Len() > 0 {
+		var ns []string
+		for i, l := 0, names.Len(); i < l; i++ {
+			ns = append(ns, strconv.Quote(string(names.Get(i))))
+		}
+
+		p.printf("reserved %s;", strings.Join(ns, ", "))
+	}
+}
+
+func (p *protoPrinter) oneof(od protoreflect.OneofDescriptor) {
+	p.leadingComments(od)
+	p.open("oneof %s", od.Name())
+	p.options(od.Options())
+
+	fields := od.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		p.field(fields.Get(i))
+	}
+
+	p.close()
+}
+
+func (p *protoPrinter) extend(extendee protoreflect.MessageDescriptor, exts []protoreflect.FieldDescriptor) {
+	p.open("extend %s", qualifiedName(extendee))
+	for _, fd := range exts {
+		p.field(fd)
+	}
+
+	p.close()
+}
+
+func (p *protoPrinter) field(fd protoreflect.FieldDescriptor) {
+	var label string
+	switch {
+	case fd.IsMap():
+	case fd.Cardinality() == protoreflect.Repeated:
+		label = "repeated "
+	case fd.Cardinality() == protoreflect.Required:
+		label = "required "
+	case fd.HasOptionalKeyword():
+		label = "optional "
+	}
+
+	var opts []string
+	if fd.HasDefault() {
+		opts = append(opts, "default = "+formatDefault(fd))
+	}
+
+	// protoc always populates json_name, so only show it if it's non-default
+	if fd.HasJSONName() && !fd.IsExtension() && fd.JSONName() != defaultJSONName(fd.Name()) {
+		opts = append(opts, "json_name = "+strconv.Quote(fd.JSONName()))
+	}
+
+	opts = append(opts, optionEntries(fd.Options())...)
+
+	var suffix string
+	if len(opts) > 0 {
+		suffix = " [" + strings.Join(opts, ", ") + "]"
+	}
+
+	p.leadingComments(fd)
+	if isGroup(fd) {
+		p.open("%sgroup %s = %d%s", label, fd.Message().Name(), fd.Number(), suffix)
+		p.messageBody(fd.Message())
+		p.close()
+		return
+	}
+
+	p.decl(fd, "%s%s %s = %d%s;", label, fieldTypeName(fd), fd.Name(), fd.Number(), suffix)
+}
+
+func (p *protoPrinter) enum(ed protoreflect.EnumDescriptor) {
+	p.leadingComments(ed)
+	p.open("enum %s", ed.Name())
+	p.options(ed.Options())
+
+	values := ed.Values()
+	for i, l := 0, values.Len(); i < l; i++ {
+		p.enumValue(values.Get(i))
+	}
+
+	// unlike message ranges, enum reserved ranges are inclusive
+	ranges := ed.ReservedRanges()
+	if ranges.Len() > 0 {
+		var rs []string
+		for i, l := 0, ranges.Len(); i < l; i++ {
+			r := ranges.Get(i)
+			rs = append(rs, formatRange(protoreflect.FieldNumber(r[0]), protoreflect.FieldNumber(r[1])))
+		}
+
+		p.printf("reserved %s;", strings.Join(rs, ", "))
+	}
+
+	names := ed.ReservedNames()
+	if names.Len() > 0 {
+		var ns []string
+		for i, l := 0, names.Len(); i < l; i++ {
+			ns = append(ns, strconv.Quote(string(names.Get(i))))
+		}
+
+		p.printf("reserved %s;", strings.Join(ns, ", "))
+	}
+
+	p.close()
+}
+
+func (p *protoPrinter) enumValue(vd protoreflect.EnumValueDescriptor) {
+	var suffix string
+	if opts := optionEntries(vd.Options()); len(opts) > 0 {
+		suffix = " [" + strings.Join(opts, ", ") + "]"
+	}
+
+	p.leadingComments(vd)
+	p.decl(vd, "%s = %d%s;", vd.Name(), vd.Number(), suffix)
+}
+
+func fieldTypeName(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", fieldTypeName(fd.MapKey()), fieldTypeName(fd.MapValue()))
+	}
+
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return qualifiedName(fd.Message())
+	case protoreflect.EnumKind:
+		return qualifiedName(fd.Enum())
+	default:
+		return fd.Kind().String()
+	}
+}
+
+// qualifiedName returns the fully-qualified name of d, with a leading dot, so
+// that it refers to d wherever it appears in .proto source. Relative names can
+// resolve to something else, e.g. when a nested message shares its name with
+// the start of the package.
+func qualifiedName(d protoreflect.Descriptor) string {
+	return "." + string(d.FullName())
+}
+
+// isGroup returns whether fd was declared with proto2 group syntax, which
+// declares a field and a message of the same name together. Editions have no
+// group syntax, but their delimited fields look like groups otherwise.
+func isGroup(fd protoreflect.FieldDescriptor) bool {
+	if fd.Kind() != protoreflect.GroupKind || fd.ParentFile().Syntax() != protoreflect.Proto2 {
+		return false
+	}
+
+	md := fd.Message()
+	return md.ParentFile().Path() == fd.ParentFile().Path() &&
+		md.FullName().Parent() == fd.FullName().Parent() &&
+		strings.ToLower(string(md.Name())) == string(fd.Name())
+}
+
+// isGroupMessage returns whether md is the message of a group.
+func isGroupMessage(md protoreflect.MessageDescriptor) bool {
+	var fields []protoreflect.FieldDescriptor
+	switch parent := md.Parent().(type) {
+	case protoreflect.MessageDescriptor:
+		for i, l := 0, parent.Fields().Len(); i < l; i++ {
+			fields = append(fields, parent.Fields().Get(i))
+		}
+
+		for i, l := 0, parent.Extensions().Len(); i < l; i++ {
+			fields = append(fields, parent.Extensions().Get(i))
+		}
+	case protoreflect.FileDescriptor:
+		for i, l := 0, parent.Extensions().Len(); i < l; i++ {
+			fields = append(fields, parent.Extensions().Get(i))
+		}
+	}
+
+	for _, fd := range fields {
+		if isGroup(fd) && fd.Message().FullName() == md.FullName() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultJSONName returns the JSON name protoc assigns to a field by default,
+// which is its name in lowerCamelCase.
+func defaultJSONName(name protoreflect.Name) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+		} else if upper && 'a' <= c && c <= 'z' {
+			b.WriteRune(c - 'a' + 'A')
+			upper = false
+		} else {
+			b.WriteRune(c)
+			upper = false
+		}
+	}
+
+	return b.String()
+}
+
+func formatDefault(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return string(fd.DefaultEnumValue().Name())
+	case protoreflect.StringKind:
+		return strconv.Quote(fd.Default().String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(fd.Default().Bytes()))
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		// .proto spells these differently to Go
+		switch f := fd.Default().Float(); {
+		case math.IsInf(f, 1):
+			return "inf"
+		case math.IsInf(f, -1):
+			return "-inf"
+		case math.IsNaN(f):
+			return "nan"
+		}
+
+		return fd.Default().String()
+	default:
+		return fd.Default().String()
+	}
+}
+
+func formatRange(start, end protoreflect.FieldNumber) string {
+	switch {
+	case start == end:
+		return strconv.Itoa(int(start))
+	case end == maxFieldNumber:
+		return fmt.Sprintf("%d to max", start)
+	default:
+		return fmt.Sprintf("%d to %d", start, end)
+	}
+}
+
+// groupExtensions groups extensions by the message they extend, preserving
+// declaration order.
+func groupExtensions(exts protoreflect.ExtensionDescriptors) [][]protoreflect.FieldDescriptor {
+	var groups [][]protoreflect.FieldDescriptor
+	index := map[protoreflect.FullName]int{}
+	for i, l := 0, exts.Len(); i < l; i++ {
+		fd := exts.Get(i)
+		name := fd.ContainingMessage().FullName()
+		if j, ok := index[name]; ok {
+			groups[j] = append(groups[j], fd)
+		} else {
+			index[name] = len(groups)
+			groups = append(groups, []protoreflect.FieldDescriptor{fd})
+		}
+	}
+
+	return groups
+}
+
+// optionEntries returns "name = value" strings for each option set in opts,
+// ordered by field number.
+func optionEntries(opts proto.Message) []string {
+	if opts == nil {
+		return nil
+	}
+
+	type entry struct {
+		num protoreflect.FieldNumber
+		s   string
+	}
+
+	var entries []entry
+	opts.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		if fd.IsExtension() {
+			name = "(" + qualifiedName(fd) + ")"
+		}
+
+		if fd.IsList() {
+			list := v.List()
+			for i, l := 0, list.Len(); i < l; i++ {
+				entries = append(entries, entry{fd.Number(), name + " = " + formatOptionValue(fd, list.Get(i))})
+			}
+		} else {
+			entries = append(entries, entry{fd.Number(), name + " = " + formatOptionValue(fd, v)})
+		}
+
+		return true
+	})
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].num < entries[j].num
+	})
+
+	var out []string
+	for _, e := range entries {
+		out = append(out, e.s)
+	}
+
+	return out
+}
+
+func formatOptionValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.StringKind:
+		return strconv.Quote(v.String())
+	case protoreflect.BytesKind:
+		return strconv.Quote(string(v.Bytes()))
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return "{ " + prototext.MarshalOptions{}.Format(v.Message().Interface()) + " }"
+	default:
+		return v.String()
+	}
+}
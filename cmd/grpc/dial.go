@@ -6,6 +6,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
+	"os"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -20,7 +21,7 @@ func dial(ctx context.Context, args args) (*grpc.ClientConn, error) {
 		return nil, err
 	}
 
-	target, isShorthand := parseTarget(args.Target)
+	target, isShorthand := parseTarget(args.Target, args.targetAliases)
 
 	var creds credentials.TransportCredentials
 	if isShorthand || args.Insecure {
@@ -29,9 +30,55 @@ func dial(ctx context.Context, args args) (*grpc.ClientConn, error) {
 		creds = credentials.NewTLS(tlsConfig)
 	}
 
-	cc, err := grpc.DialContext(ctx, target, grpc.WithTransportCredentials(creds), grpc.WithUserAgent(args.UserAgent))
+	var log *verboseLogger
+	if args.Verbose {
+		log = &verboseLogger{w: os.Stderr}
+		if args.profile != "" {
+			log.printf("*", "using profile %q from %s", args.profile, args.profilePath)
+		}
+
+		if target != args.Target {
+			log.printf("*", "target: %s (from %q)", target, args.Target)
+		} else {
+			log.printf("*", "target: %s", target)
+		}
+
+		logCredentials(log, args, isShorthand, tlsConfig)
+		creds = verboseCreds{TransportCredentials: creds, log: log}
+	}
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds), grpc.WithUserAgent(args.UserAgent)}
+	if log != nil {
+		opts = append(opts, grpc.WithStatsHandler(verboseStatsHandler{log: log}))
+	}
+
+	// the connection outlives dial, so log its state until the caller is done
+	// with it, not just until the --connect-timeout below
+	stateCtx := ctx
+
+	if args.ConnectTimeout > 0 {
+		// a timeout is only meaningful if we wait for the connection to be
+		// established before returning
+		opts = append(opts, grpc.WithBlock(), grpc.WithReturnConnectionError())
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, seconds(args.ConnectTimeout))
+		defer cancel()
+	}
+
+	cc, err := grpc.DialContext(ctx, target, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("dial: %w", err)
+		// if --max-time ran out first, ctx ran out because its parent did,
+		// and humanizeConnErr blames --max-time instead
+		if ctx.Err() == context.DeadlineExceeded && stateCtx.Err() == nil {
+			return nil, fmt.Errorf("dial: %w (could not connect to server within --connect-timeout)", err)
+		}
+
+		return nil, fmt.Errorf("dial: %w", humanizeConnErr(args, err))
+	}
+
+	if log != nil {
+		logConnState(stateCtx, log, cc)
 	}
 
 	return cc, nil
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	encodingJSON   = "json"
+	encodingText   = "text"
+	encodingBinary = "binary"
+	encodingBase64 = "base64"
+	encodingYAML   = "yaml"
+)
+
+var (
+	inputEncodings  = []string{encodingJSON, encodingText, encodingBinary, encodingBase64, encodingYAML}
+	outputEncodings = []string{encodingJSON, encodingText, encodingBinary, encodingBase64}
+)
+
+// textSeparator is the line that separates messages in a stream of Protobuf
+// text format messages. Text format strings can't contain newlines, so this
+// can't be mistaken for part of a message.
+const textSeparator = "---"
+
+// messageDecoder reads messages from a stream of encoded messages.
+type messageDecoder interface {
+	// decode reads the next message in the stream into msg. At the end of the
+	// stream, decode returns io.EOF.
+	decode(msg proto.Message) error
+}
+
+// messageEncoder writes messages to a stream of encoded messages.
+type messageEncoder interface {
+	encode(msg proto.Message) error
+}
+
+// validateEncodings returns an error if --in or --out isn't a known encoding.
+func (args args) validateEncodings() error {
+	if args.In != "" && !contains(inputEncodings, args.In) {
+		return fmt.Errorf("--in: must be one of %q, got: %q", inputEncodings, args.In)
+	}
+
+	if args.Out != "" && !contains(outputEncodings, args.Out) {
+		return fmt.Errorf("--out: must be one of %q, got: %q", outputEncodings, args.Out)
+	}
+
+	if args.Envelope && args.Out != "" && args.Out != encodingJSON {
+		return fmt.Errorf("--envelope: can only be used with --out %s", encodingJSON)
+	}
+
+	if args.JSONArray && args.In != "" && args.In != encodingJSON {
+		return fmt.Errorf("--json-array: can only be used with --in %s", encodingJSON)
+	}
+
+	if args.TemplateVars && args.In != "" && !contains(templateVarsEncodings, args.In) {
+		return fmt.Errorf("--template-vars: can only be used with --in %s", strings.Join(templateVarsEncodings, ", "))
+	}
+
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, e := range ss {
+		if s == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newDecoder returns a decoder for messages read from r, in the --in encoding.
+func (args args) newDecoder(r io.Reader) messageDecoder {
+	if args.TemplateVars {
+		r = newTemplateReader(r)
+	}
+
+	switch args.In {
+	case encodingText:
+		return &textDecoder{r: bufio.NewReader(r), opts: prototext.UnmarshalOptions{DiscardUnknown: args.discardUnknown(), Resolver: args.resolver}}
+	case encodingBinary:
+		return &binaryDecoder{r: bufio.NewReader(r), opts: protodelim.UnmarshalOptions{
+			UnmarshalOptions: proto.UnmarshalOptions{DiscardUnknown: args.discardUnknown()},
+			MaxSize:          -1,
+		}}
+	case encodingBase64:
+		return &base64Decoder{r: bufio.NewReader(r), opts: proto.UnmarshalOptions{DiscardUnknown: args.discardUnknown()}}
+	case encodingYAML:
+		return &yamlDecoder{dec: yaml.NewDecoder(r), opts: args.unmarshalOptions()}
+	default:
+		return jsonDecoder{r: newJSONMessageReader(r, args.JSONArray), args: args}
+	}
+}
+
+// newEncoder returns an encoder for messages written to w, in the --out
+// encoding.
+func (args args) newEncoder(w io.Writer) messageEncoder {
+	switch args.Out {
+	case encodingText:
+		opts := prototext.MarshalOptions{Multiline: true, Indent: "  ", Resolver: args.resolver}
+		if args.Indent != "" {
+			opts.Indent = args.Indent
+		}
+
+		return &textEncoder{w: w, opts: opts}
+	case encodingBinary:
+		return binaryEncoder{w: w}
+	case encodingBase64:
+		return base64Encoder{w: w}
+	default:
+		return jsonEncoder{w: w, args: args}
+	}
+}
+
+// jsonDecoder decodes a stream of protojson messages. See jsonMessageReader for
+// how the stream is split into messages.
+type jsonDecoder struct {
+	r    *jsonMessageReader
+	args args
+}
+
+func (d jsonDecoder) decode(msg proto.Message) error {
+	b, offset, err := d.r.next()
+	if err != nil {
+		return err
+	}
+
+	if err := d.args.unmarshalOptions().Unmarshal(b, msg); err != nil {
+		return fmt.Errorf("message %d (at byte offset %d): %w", d.r.index-1, offset, err)
+	}
+
+	return nil
+}
+
+type jsonEncoder struct {
+	w    io.Writer
+	args args
+}
+
+func (e jsonEncoder) encode(msg proto.Message) error {
+	b, err := e.args.marshalMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.w, string(b))
+	return err
+}
+
+// textDecoder decodes a stream of Protobuf text format messages, separated by
+// textSeparator lines.
+type textDecoder struct {
+	r     *bufio.Reader
+	opts  prototext.UnmarshalOptions
+	index int
+	line  int
+}
+
+func (d *textDecoder) decode(msg proto.Message) error {
+	start := d.line + 1
+
+	var b strings.Builder
+	var eof bool
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("message %d: %w", d.index, err)
+		}
+
+		eof = err == io.EOF
+		if line != "" {
+			d.line++
+		}
+
+		if strings.TrimSpace(line) == textSeparator {
+			break
+		}
+
+		b.WriteString(line)
+		if eof {
+			break
+		}
+	}
+
+	// a separator may optionally follow the last message
+	if eof && strings.TrimSpace(b.String()) == "" {
+		return io.EOF
+	}
+
+	index := d.index
+	d.index++
+	if err := d.opts.Unmarshal([]byte(b.String()), msg); err != nil {
+		return fmt.Errorf("message %d (starting at line %d): %w", index, start, err)
+	}
+
+	return nil
+}
+
+type textEncoder struct {
+	w     io.Writer
+	opts  prototext.MarshalOptions
+	count int
+}
+
+func (e *textEncoder) encode(msg proto.Message) error {
+	if e.count > 0 {
+		if _, err := fmt.Fprintln(e.w, textSeparator); err != nil {
+			return err
+		}
+	}
+
+	e.count++
+
+	b, err := e.opts.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(b)
+	return err
+}
+
+// binaryDecoder decodes a stream of length-delimited Protobuf binary messages,
+// the same format used by Java's parseDelimitedFrom and writeDelimitedTo.
+type binaryDecoder struct {
+	r     *bufio.Reader
+	opts  protodelim.UnmarshalOptions
+	index int
+}
+
+func (d *binaryDecoder) decode(msg proto.Message) error {
+	if err := d.opts.UnmarshalFrom(d.r, msg); err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+
+		return fmt.Errorf("message %d: %w", d.index, err)
+	}
+
+	d.index++
+	return nil
+}
+
+type binaryEncoder struct {
+	w io.Writer
+}
+
+func (e binaryEncoder) encode(msg proto.Message) error {
+	_, err := protodelim.MarshalTo(e.w, msg)
+	return err
+}
+
+// base64Decoder decodes a stream of base64-encoded Protobuf binary messages,
+// one per line. Blank lines are ignored.
+type base64Decoder struct {
+	r     *bufio.Reader
+	opts  proto.UnmarshalOptions
+	index int
+	line  int
+}
+
+func (d *base64Decoder) decode(msg proto.Message) error {
+	for {
+		line, err := d.r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("message %d: %w", d.index, err)
+		}
+
+		if line != "" {
+			d.line++
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err == io.EOF {
+				return io.EOF
+			}
+
+			continue
+		}
+
+		index := d.index
+		d.index++
+
+		// accept input with or without padding
+		b, decodeErr := base64.RawStdEncoding.DecodeString(strings.TrimRight(line, "="))
+		if decodeErr != nil {
+			return fmt.Errorf("message %d (at line %d): invalid base64: %w", index, d.line, decodeErr)
+		}
+
+		if err := d.opts.Unmarshal(b, msg); err != nil {
+			return fmt.Errorf("message %d (at line %d): %w", index, d.line, err)
+		}
+
+		return nil
+	}
+}
+
+type base64Encoder struct {
+	w io.Writer
+}
+
+func (e base64Encoder) encode(msg proto.Message) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(e.w, base64.StdEncoding.EncodeToString(b))
+	return err
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// envelope is the output of --envelope: everything about an RPC, as a single
+// JSON document.
+type envelope struct {
+	Header   metadata.MD       `json:"header"`
+	Messages []envelopeMessage `json:"messages"`
+	Trailer  metadata.MD       `json:"trailer"`
+	Status   statusErrorJSON   `json:"status"`
+
+	// Duration is the time the RPC took, in seconds
+	Duration float64 `json:"duration"`
+
+	start time.Time
+}
+
+type envelopeMessage struct {
+	Index   int             `json:"index"`
+	Time    time.Time       `json:"time"`
+	Message json.RawMessage `json:"message"`
+}
+
+func newEnvelope() *envelope {
+	return &envelope{
+		Header:   metadata.MD{},
+		Messages: []envelopeMessage{},
+		Trailer:  metadata.MD{},
+		start:    time.Now(),
+	}
+}
+
+// setHeader records the RPC's response headers.
+func (e *envelope) setHeader(md metadata.MD) {
+	e.Header = envelopeMetadata(md)
+}
+
+// setTrailer records the RPC's trailers.
+func (e *envelope) setTrailer(md metadata.MD) {
+	e.Trailer = envelopeMetadata(md)
+}
+
+// envelopeMetadata returns md with binary values base64-encoded, the same way
+// gRPC encodes them on the wire; otherwise, they would be mangled by JSON.
+func envelopeMetadata(md metadata.MD) metadata.MD {
+	out := metadata.MD{}
+	for k, vs := range md {
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+
+			out[k] = append(out[k], v)
+		}
+	}
+
+	return out
+}
+
+// addMessage adds a received message, already encoded as JSON.
+func (e *envelope) addMessage(b []byte) {
+	e.Messages = append(e.Messages, envelopeMessage{Index: len(e.Messages), Time: time.Now(), Message: b})
+}
+
+// finish records s as the final status of the RPC, and returns the envelope
+// encoded as JSON.
+func (e *envelope) finish(args args, s *status.Status, details []json.RawMessage) ([]byte, error) {
+	e.Duration = time.Since(e.start).Seconds()
+	e.Status = statusErrorJSON{Code: s.Code(), Name: s.Code().String(), Message: s.Message(), Details: details}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("marshal envelope: %w", err)
+	}
+
+	return args.formatJSON(b)
+}
+
+// okStatus is the status of a successful RPC.
+var okStatus = status.New(codes.OK, "")
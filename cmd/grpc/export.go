@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// prepareExport checks the export flags, and sets up export to fetch the
+// schema afresh.
+func (args *args) prepareExport() error {
+	if args.ProtosetOut == "" && args.ProtoDir == "" {
+		return fmt.Errorf("export: at least one of --protoset-out or --proto-dir is required")
+	}
+
+	for _, path := range args.Protoset {
+		if filepath.Clean(path) == filepath.Clean(args.ProtosetOut) {
+			return fmt.Errorf("--protoset-out: refusing to overwrite --protoset file %s", path)
+		}
+	}
+
+	// an export should reflect the server as it is now, not as it was cached
+	args.RefreshCache = true
+	return nil
+}
+
+func exportSchema(msrc methodSource, args args) error {
+	var roots []protoreflect.FileDescriptor
+	if len(args.Symbols) == 0 {
+		// with no symbol, export every service
+		methods, err := msrc.Methods()
+		if err != nil {
+			return err
+		}
+
+		for _, m := range methods {
+			roots = append(roots, m.ParentFile())
+		}
+	}
+
+	for _, s := range args.Symbols {
+		d, err := msrc.Descriptor(protoreflect.FullName(s))
+		if err != nil {
+			return err
+		}
+
+		roots = append(roots, d.ParentFile())
+	}
+
+	var files []protoreflect.FileDescriptor
+	seen := map[string]bool{}
+	for _, fd := range roots {
+		files = appendFileWithImports(files, seen, fd)
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	for _, fd := range files {
+		fds.File = append(fds.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	if args.ProtosetOut != "" {
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(&fds)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(args.ProtosetOut, b, 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", args.ProtosetOut, err)
+		}
+	}
+
+	if args.ProtoDir != "" {
+		for _, fd := range files {
+			// the standard imports are built into protoc and grpc, and
+			// regenerating them would only risk shadowing the real thing
+			if strings.HasPrefix(fd.Path(), "google/protobuf/") {
+				continue
+			}
+
+			path := filepath.Join(args.ProtoDir, filepath.FromSlash(fd.Path()))
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+
+			if err := os.WriteFile(path, []byte(describeFile(fd)), 0o644); err != nil {
+				return fmt.Errorf("write %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// appendFileWithImports appends fd to files, after its transitive imports,
+// which is the order protoc's --include_imports uses.
+func appendFileWithImports(files []protoreflect.FileDescriptor, seen map[string]bool, fd protoreflect.FileDescriptor) []protoreflect.FileDescriptor {
+	if seen[fd.Path()] {
+		return files
+	}
+
+	seen[fd.Path()] = true
+
+	imports := fd.Imports()
+	for i, l := 0, imports.Len(); i < l; i++ {
+		files = appendFileWithImports(files, seen, imports.Get(i).FileDescriptor)
+	}
+
+	return append(files, fd)
+}
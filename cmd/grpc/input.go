@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonMessageReader splits a stream of JSON into individual messages. Messages
+// are top-level JSON values, separated by optional whitespace. If array is
+// true, then top-level values are instead arrays whose elements are messages.
+//
+// Unlike bufio.Scanner, messages may span multiple lines and have no length
+// limit.
+type jsonMessageReader struct {
+	dec     *json.Decoder
+	array   bool
+	inArray bool
+	index   int
+}
+
+func newJSONMessageReader(r io.Reader, array bool) *jsonMessageReader {
+	return &jsonMessageReader{dec: json.NewDecoder(r), array: array}
+}
+
+// next returns the next message, and the byte offset in the stream where it
+// starts. At the end of the stream, next returns io.EOF.
+func (r *jsonMessageReader) next() (json.RawMessage, int64, error) {
+	if r.array && !r.inArray {
+		if err := r.openArray(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if r.array && !r.dec.More() {
+		// consume the closing bracket, and look for another array
+		if _, err := r.dec.Token(); err != nil {
+			return nil, 0, r.syntaxErr(err)
+		}
+
+		r.inArray = false
+		return r.next()
+	}
+
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		if err == io.EOF && !r.inArray {
+			return nil, 0, io.EOF
+		}
+
+		return nil, 0, r.syntaxErr(err)
+	}
+
+	offset := r.dec.InputOffset() - int64(len(raw))
+	r.index++
+	return raw, offset, nil
+}
+
+func (r *jsonMessageReader) openArray() error {
+	tok, err := r.dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			return io.EOF
+		}
+
+		return r.syntaxErr(err)
+	}
+
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("message %d: expected JSON array (at byte offset %d), got: %v", r.index, r.dec.InputOffset(), tok)
+	}
+
+	r.inArray = true
+	return nil
+}
+
+// syntaxErr annotates a JSON syntax error with the index of the message it
+// occurred in.
+func (r *jsonMessageReader) syntaxErr(err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("message %d: invalid JSON at byte offset %d: %w", r.index, syntaxErr.Offset, err)
+	}
+
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return fmt.Errorf("message %d: unexpected end of input at byte offset %d", r.index, r.dec.InputOffset())
+	}
+
+	return fmt.Errorf("message %d: %w", r.index, err)
+}
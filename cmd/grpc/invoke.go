@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,7 +12,8 @@ import (
 	"golang.org/x/term"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
@@ -29,6 +29,36 @@ func invokeMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, a
 		ClientStreams: method.IsStreamingClient(),
 	}
 
+	var env *envelope
+	if args.Envelope {
+		env = newEnvelope()
+	}
+
+	// in --interactive mode, input and output go through the terminal, and
+	// the user can cancel the RPC
+	stdout, stderr := io.Writer(os.Stdout), io.Writer(os.Stderr)
+	var repl *replTerminal
+	var replHdr replHeader
+	if args.Interactive {
+		if !method.IsStreamingClient() {
+			return fmt.Errorf("--interactive: %s is not a client-streaming method", method.FullName())
+		}
+
+		repl, err = newREPLTerminal()
+		if err != nil {
+			return err
+		}
+
+		defer repl.restore()
+		stdout, stderr = repl, repl
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// done is closed once the RPC's output has all been received
+	done := make(chan struct{})
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	stream, err := cc.NewStream(ctx, &streamDesc, methodInvokeName(string(method.FullName())))
@@ -36,23 +66,15 @@ func invokeMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, a
 		return humanizeConnErr(args, err)
 	}
 
-	// warn about stdin being a tty
-	if !args.NoWarnStdinTTY && term.IsTerminal(int(os.Stdin.Fd())) {
-		_, _ = fmt.Fprintln(os.Stderr, "warning: reading message(s) from stdin (disable this message with --no-warn-stdin-tty)")
-	}
-
-	// write stdin to stream
+	// write input to stream
 	g.Go(func() error {
-		scan := bufio.NewScanner(os.Stdin)
-		for scan.Scan() {
-			msg := dynamicpb.NewMessage(method.Input())
-			if err := protojson.Unmarshal(scan.Bytes(), msg); err != nil {
-				return err
-			}
+		if repl != nil {
+			return runREPL(ctx, cancel, repl, stream, method, args, &replHdr, done)
+		}
 
-			if err := stream.SendMsg(msg); err != nil {
-				return err
-			}
+		send := func(msg proto.Message) error { return stream.SendMsg(msg) }
+		if err := readInput(ctx, method, args, send); err != nil {
+			return err
 		}
 
 		return stream.CloseSend()
@@ -60,20 +82,30 @@ func invokeMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, a
 
 	// write stream to stdout (and header/trailer to stderr)
 	g.Go(func() error {
+		defer close(done)
+
 		header, err := stream.Header()
 		if err != nil {
 			return err
 		}
 
+		replHdr.set(header)
+
+		if env != nil {
+			env.setHeader(header)
+		}
+
 		if args.DumpHeader {
 			log, err := json.Marshal(headerTrailer{Header: header})
 			if err != nil {
 				return fmt.Errorf("marshal header/trailer: %w", err)
 			}
 
-			_, _ = fmt.Fprintln(os.Stderr, string(log))
+			_, _ = fmt.Fprintln(stderr, string(log))
 		}
 
+		enc := args.newEncoder(stdout)
+		parseExts := mayHaveExtensions(method.Output(), map[protoreflect.FullName]bool{})
 		for {
 			msg := dynamicpb.NewMessage(method.Output())
 			if err := stream.RecvMsg(msg); err != nil {
@@ -84,12 +116,25 @@ func invokeMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, a
 				return err
 			}
 
-			b, err := protojson.Marshal(msg)
-			if err != nil {
-				return err
+			if parseExts {
+				if err := args.parseExtensions(msg); err != nil {
+					return err
+				}
 			}
 
-			fmt.Println(string(b))
+			if env != nil {
+				b, err := args.marshalMessage(msg)
+				if err != nil {
+					return err
+				}
+
+				env.addMessage(b)
+				continue
+			}
+
+			if err := enc.encode(msg); err != nil {
+				return err
+			}
 		}
 
 		trailer := stream.Trailer()
@@ -99,13 +144,176 @@ func invokeMethod(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, a
 				return fmt.Errorf("marshal header/trailer: %w", err)
 			}
 
-			_, _ = fmt.Fprintln(os.Stderr, string(log))
+			_, _ = fmt.Fprintln(stderr, string(log))
 		}
 
 		return nil
 	})
 
-	return g.Wait()
+	err = g.Wait()
+	if repl != nil {
+		repl.restore()
+	}
+
+	if env != nil {
+		if err := printEnvelope(env, stream, msrc, args, err); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		return humanizeConnErr(args, err)
+	}
+
+	return nil
+}
+
+// printEnvelope outputs env, given that the RPC on stream ended with rpcErr.
+func printEnvelope(env *envelope, stream grpc.ClientStream, msrc methodSource, args args, rpcErr error) error {
+	s := okStatus
+	var details []json.RawMessage
+	if rpcErr != nil {
+		var ok bool
+		s, ok = rpcStatus(rpcErr)
+		if !ok {
+			// the RPC didn't fail, we did (e.g. because of invalid input), so
+			// there's no status to report
+			return nil
+		}
+
+		details = marshalStatusDetails(newTypeResolver(msrc), s)
+	}
+
+	// the stream is done at this point, so its trailer is available, even if
+	// the RPC failed
+	env.setTrailer(stream.Trailer())
+
+	b, err := env.finish(args, s, details)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(b))
+	return nil
+}
+
+// readInput reads the input messages for method from --data, or stdin by
+// default, and calls send with each of them.
+func readInput(ctx context.Context, method protoreflect.MethodDescriptor, args args, send func(proto.Message) error) error {
+	data := args.inputData(method)
+	if data == nil {
+		// there's only one possible input, so don't make the user send it
+		return send(dynamicpb.NewMessage(method.Input()))
+	}
+
+	for _, d := range data {
+		if err := readData(ctx, method, args, d, send); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// inputData returns where to read method's input from: --data, or stdin by
+// default. It returns nil if there's no need for input at all.
+func (args args) inputData(method protoreflect.MethodDescriptor) []string {
+	data := args.Data
+	if len(data) == 0 {
+		if method.Input().FullName() == "google.protobuf.Empty" && !method.IsStreamingClient() {
+			return nil
+		}
+
+		data = []string{"@-"}
+	}
+
+	// warn about stdin being a tty
+	for _, d := range data {
+		if d == "@-" && !args.NoWarnStdinTTY && term.IsTerminal(int(os.Stdin.Fd())) {
+			_, _ = fmt.Fprintln(os.Stderr, "warning: reading message(s) from stdin (disable this message with --no-warn-stdin-tty)")
+			break
+		}
+	}
+
+	return data
+}
+
+// readData reads the messages in d, which is either inline data, "@-" for
+// stdin, or "@" followed by a file name.
+func readData(ctx context.Context, method protoreflect.MethodDescriptor, args args, d string, send func(proto.Message) error) error {
+	r, name, err := openData(d)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	return dataError(name, readMessages(ctx, method, args, r, send))
+}
+
+// openData opens d, as described in readData. It also returns a name for d to
+// use in errors, which is empty for stdin.
+func openData(d string) (io.ReadCloser, string, error) {
+	switch {
+	case d == "@-":
+		return io.NopCloser(os.Stdin), "", nil
+	case strings.HasPrefix(d, "@"):
+		f, err := os.Open(d[1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("--data: %w", err)
+		}
+
+		return f, d[1:], nil
+	default:
+		return io.NopCloser(strings.NewReader(d)), "--data", nil
+	}
+}
+
+// dataError adds the name of the data being read to err, if any.
+func dataError(name string, err error) error {
+	if err != nil && name != "" {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return err
+}
+
+func readMessages(ctx context.Context, method protoreflect.MethodDescriptor, args args, in io.Reader, send func(proto.Message) error) error {
+	type next struct {
+		msg *dynamicpb.Message
+		err error
+	}
+
+	dec := args.newDecoder(in)
+	for {
+		// reading input (e.g. stdin) can block indefinitely and can't be
+		// interrupted, so read in the background and give up if the RPC ends
+		// first; otherwise, a failed or timed-out RPC would wait on input
+		nextc := make(chan next, 1)
+		go func() {
+			msg := dynamicpb.NewMessage(method.Input())
+			nextc <- next{msg, dec.decode(msg)}
+		}()
+
+		var n next
+		select {
+		case n = <-nextc:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		if n.err != nil {
+			if n.err == io.EOF {
+				return nil
+			}
+
+			return n.err
+		}
+
+		if err := send(n.msg); err != nil {
+			return err
+		}
+	}
 }
 
 type headerTrailer struct {
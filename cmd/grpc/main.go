@@ -1,20 +1,39 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/ucarion/cli"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 type args struct {
 	Target                   string   `cli:"target"`
 	Method                   string   `cli:"method"`
+	Symbols                  []string `cli:"symbol..."`
+	Profile                  string   `cli:"-p,--profile" value:"name" usage:"use the named profile from the config file; default is the profile for TARGET, if any"`
+	Config                   string   `cli:"--config" value:"file" usage:"config file to use; default is grpcake/config.toml in the user config directory (e.g. ~/.config)"`
 	Long                     bool     `cli:"-l,--long" usage:"if listing methods, output in long format"`
 	Protoset                 []string `cli:"--protoset" value:"file" usage:"get schema from .protoset file(s); can be provided multiple times"`
+	Proto                    []string `cli:"--proto" value:"file" usage:"get schema from .proto source file(s); can be provided multiple times"`
+	ProtosetOut              string   `cli:"--protoset-out" value:"file" usage:"export: write the schema to this .protoset file"`
+	ProtoDir                 string   `cli:"--proto-dir" value:"dir" usage:"export: write .proto source files regenerated from the schema to this directory"`
+	ImportPath               []string `cli:"-I,--import-path" value:"dir" usage:"directory to search for imports of --proto files; can be provided multiple times"`
+	Reflect                  string   `cli:"--reflect" value:"mode" usage:"when to use reflection: 'auto' (default) uses it only without --protoset or --proto; 'first' tries it before those files, and 'last' after them"`
+	ReflectVersion           string   `cli:"--reflect-version" value:"version" usage:"reflection API version to use: 'v1', 'v1alpha', or 'auto'; default is auto, which tries v1 and then v1alpha"`
+	NoCache                  bool     `cli:"--no-cache" usage:"don't read or write the cache of descriptors fetched via reflection"`
+	RefreshCache             bool     `cli:"--refresh-cache" usage:"fetch descriptors via reflection even if they're cached, and update the cache"`
+	CacheTTL                 float64  `cli:"--cache-ttl" value:"seconds" usage:"how long to use cached descriptors for; default is 600 (10 minutes)"`
 	UserAgent                string   `cli:"-A,--user-agent" value:"user-agent" usage:"user-agent string to use in all RPCs"`
 	Header                   []string `cli:"-H,--header" value:"header" usage:"metadata header key/value pair, of the form 'key: value'"`
 	HeaderRawKey             []string `cli:"--header-raw-key" value:"raw-key" usage:"metadata header key; use in pairs with --header-raw-value"`
@@ -25,8 +44,31 @@ type args struct {
 	RPCHeader                []string `cli:"--rpc-header" value:"header" usage:"metadata header key/value pair to use only in non-reflection RPCs, of the form 'key: value'"`
 	RPCHeaderRawKey          []string `cli:"--rpc-header-raw-key" value:"raw-key" usage:"metadata header key to use only in non-reflection RPCs; use in pairs with --rpc-header-raw-value"`
 	RPCHeaderRawValue        []string `cli:"--rpc-header-raw-value" value:"raw-value" usage:"metadata header value to use only in non-reflection RPCs"`
+	Data                     []string `cli:"-d,--data" value:"data" usage:"send data as input instead of reading stdin; use @file to read from a file, or @- for stdin; can be provided multiple times"`
+	TemplateVars             bool     `cli:"--template-vars" usage:"expand ${ENV_VAR}s and {{...}} templates (e.g. {{uuid}}, {{now}}) in input and header values"`
+	Interactive              bool     `cli:"-i,--interactive" usage:"for client-streaming methods, enter messages one at a time at a prompt, and output responses as they arrive"`
+	In                       string   `cli:"--in" value:"encoding" usage:"encoding of input messages: 'json' (default), 'yaml', 'text', 'binary', or 'base64'"`
+	Out                      string   `cli:"--out" value:"encoding" usage:"encoding of output messages: 'json' (default), 'text', 'binary', or 'base64'"`
+	JSONArray                bool     `cli:"--json-array" usage:"read input as JSON array(s) of messages, instead of a sequence of JSON messages"`
+	Pretty                   bool     `cli:"--pretty" usage:"output indented, multi-line JSON"`
+	Indent                   string   `cli:"--indent" value:"indent" usage:"string to indent output JSON with; implies --pretty"`
+	EmitDefaults             bool     `cli:"--emit-defaults" usage:"output fields even if they have default values, instead of omitting them"`
+	UseProtoNames            bool     `cli:"--use-proto-names" usage:"output fields with their .proto names (e.g. foo_bar), instead of lowerCamelCase names (e.g. fooBar)"`
+	EnumsAsInts              bool     `cli:"--enums-as-ints" usage:"output enum values as numbers, instead of names"`
+	DiscardUnknown           bool     `cli:"--discard-unknown" usage:"ignore unknown fields in input, instead of failing"`
+	AllowUnknownFields       bool     `cli:"--allow-unknown-fields" usage:"same as --discard-unknown"`
+	ErrorFormat              string   `cli:"--error-format" value:"format" usage:"format to output RPC errors to stderr in: 'text' (default) or 'json'"`
+	Envelope                 bool     `cli:"--envelope" usage:"output a single JSON document with the RPC's headers, messages, trailers, status, and duration"`
+	Calls                    int      `cli:"-n,--calls" value:"n" usage:"bench: total number of calls to make; default is 200, unless --duration is given"`
+	Duration                 float64  `cli:"--duration" value:"seconds" usage:"bench: make calls for this many seconds"`
+	Concurrency              int      `cli:"-c,--concurrency" value:"n" usage:"bench: number of calls to make concurrently; default is 1"`
+	QPS                      float64  `cli:"--qps" value:"qps" usage:"bench: maximum number of calls to start per second, across all concurrent calls; default is no limit"`
+	BenchFormat              string   `cli:"--bench-format" value:"format" usage:"bench: format to output results in: 'text' (default) or 'json'"`
 	DumpHeader               bool     `cli:"--dump-header" usage:"dump server metadata headers to stderr"`
 	DumpTrailer              bool     `cli:"--dump-trailer" usage:"dump server metadata trailers to stderr"`
+	MaxTime                  float64  `cli:"-m,--max-time" value:"seconds" usage:"maximum time, in seconds, that the whole operation may take; sets a deadline on RPCs"`
+	ConnectTimeout           float64  `cli:"--connect-timeout" value:"seconds" usage:"maximum time, in seconds, to wait for a connection to the server"`
+	Verbose                  bool     `cli:"-v,--verbose" usage:"output details about the connection and RPCs to stderr"`
 	Insecure                 bool     `cli:"-k,--insecure" usage:"disable TLS; default is to validate TLS if target is not a localhost shorthand"`
 	InsecureSkipServerVerify bool     `cli:"--insecure-skip-server-verify" usage:"when using TLS, skip verifying the server's certificate chain and host name"`
 	ServerRootCA             []string `cli:"--server-root-ca" value:"ca-cert" usage:"server root CA; default is to use system cert pool"`
@@ -34,6 +76,18 @@ type args struct {
 	ClientCert               []string `cli:"--client-cert" value:"cert-file" usage:"client cert (i.e. public key) file; enables mutual TLS"`
 	ClientKey                []string `cli:"--client-key" value:"key-file" usage:"client key (i.e. private key) file"`
 	NoWarnStdinTTY           bool     `cli:"--no-warn-stdin-tty" usage:"disable warnings about stdin being a tty"`
+
+	// targetAliases are the target aliases from the config file
+	targetAliases map[string]string
+
+	// profile is the name of the profile in use, and profilePath is the
+	// config file it's from
+	profile     string
+	profilePath string
+
+	// resolver resolves the types of google.protobuf.Any values in input and
+	// output messages, using the method source
+	resolver protojsonResolver
 }
 
 func (_ args) Description() string {
@@ -60,8 +114,55 @@ For example:
 If METHOD is client-streaming, then pipe in a sequence of JSON messages instead.
 If METHOD is server-streaming, gRPCake will output a stream of JSON messages.
 
+To pass input as an argument instead of from stdin, use "-d" or "--data". Like
+curl, "-d @file" reads input from a file, and "-d @-" reads from stdin. You can
+pass "-d" multiple times to send messages to client-streaming methods:
+
+	grpc localhost:50051 echo.Echo.ClientStreamEcho -d '{"message": "a"}' -d @b.json
+
+For client-streaming and bidi-streaming methods, "-i" or "--interactive" lets
+you enter messages at a prompt, with line editing and history. Each message is
+sent as soon as you enter it, and responses are output as they arrive. Enter ".close" (or press Ctrl-D)
+to close the stream, ".cancel" (or press Ctrl-C) to cancel the RPC, and
+".headers" to show the response headers:
+
+	grpc localhost:50051 echo.Echo.BidiStreamEcho -i
+
+If METHOD takes a google.protobuf.Empty as input, and isn't client-streaming,
+then you don't need to provide any input at all.
+
+Input messages can be separated by any whitespace, and each message can span
+multiple lines, so pretty-printed JSON works too. To instead pass messages as
+the elements of a JSON array, use "--json-array":
+
+	echo '[{"message": "a"}, {"message": "b"}]' | grpc --json-array ...
+
 gRPCake discovers methods using reflection by default. To discover using a
-".protoset" file instead, use "--protoset".
+".protoset" file instead, use "--protoset". To discover using ".proto" source
+files instead, use "--proto", and use "-I" or "--import-path" to tell gRPCake
+where to find imported files:
+
+	grpc -I protos --proto protos/echo.proto : echo.Echo.Echo
+
+Standard imports, like "google/protobuf/empty.proto", are built into gRPCake,
+so you don't need to put them on your import path.
+
+To use "--protoset" or "--proto" files together with reflection, e.g. for
+error detail types the server doesn't expose, use "--reflect last" to look up
+types in the files before using reflection, or "--reflect first" to use
+reflection before the files. If a file is defined differently by the two,
+gRPCake warns about it, and uses whichever definition it found first.
+
+gRPCake first tries the "grpc.reflection.v1" reflection API, and falls back to
+"grpc.reflection.v1alpha" if the server doesn't implement v1. To only use one or
+the other, use "--reflect-version v1" or "--reflect-version v1alpha".
+
+gRPCake caches descriptors fetched via reflection for 10 minutes, in
+"grpcake/descriptors" in the user cache directory (e.g. ~/.cache), so that it
+doesn't need to fetch them every time. Anything not in the cache is looked up
+via reflection anyway. To skip the cache, use "--no-cache". To fetch and cache
+descriptors again, use "--refresh-cache". To change how long they're cached
+for, use "--cache-ttl" with a number of seconds.
 
 If METHOD is "ls" or "ll", then gRPCake lists available methods. For example:
 
@@ -72,8 +173,67 @@ If METHOD is "ls" or "ll", then gRPCake lists available methods. For example:
 	echo.Echo.ServerStreamEcho
 	echo.Echo.BidiStreamEcho
 	echo.Echo.EchoMetadata
+	echo.Echo.EchoError
+	grpc.reflection.v1.ServerReflection.ServerReflectionInfo
 	grpc.reflection.v1alpha.ServerReflection.ServerReflectionInfo
 
+If METHOD is "describe", then gRPCake prints the schema of each SYMBOL, which
+can be the full name of a service, method, message, or enum. The schema is
+printed in the same syntax as a ".proto" file, including comments if they're
+available. For example:
+
+	$ grpc localhost:50051 describe echo.MetadataMessage
+	message MetadataMessage {
+	  map<string, .echo.MetadataMessage.Values> metadata = 1;
+	  message Values {
+	    repeated string values = 1;
+	  }
+	}
+
+If no SYMBOL is given, gRPCake describes every available service.
+
+If METHOD is "export", then gRPCake saves the schema of every available service,
+or of the files defining each SYMBOL, along with everything they import. Use
+"--protoset-out" to write a ".protoset" file, and "--proto-dir" to write
+".proto" source files to a directory. Either can be used later to call TARGET
+without reflection:
+
+	grpc localhost:50051 export --protoset-out echo.protoset
+	grpc --protoset echo.protoset localhost:50051 echo.Echo.Echo
+
+If METHOD is "template", then gRPCake outputs a JSON template for the input of
+the method SYMBOL, with every field set to a placeholder value. You can edit the
+template and pipe it back into gRPCake:
+
+	$ grpc localhost:50051 template echo.Echo.Echo
+	{
+	  "message": ""
+	}
+
+If METHOD is "bench", then gRPCake load tests the method SYMBOL, by calling it
+repeatedly and reporting throughput, latencies, and status codes. Each call
+sends one input message; if you provide multiple input messages, gRPCake
+cycles through them. For example, to make 1000 calls, 10 at a time:
+
+	grpc localhost:50051 bench echo.Echo.Echo -n 1000 -c 10 -d @messages.json
+
+Use "-n" or "--calls" to set the total number of calls, or "--duration" to make
+calls for a number of seconds instead. Use "-c" or "--concurrency" to make
+multiple calls at a time, and "--qps" to limit how many calls start per second.
+To output results as JSON, use "--bench-format json".
+
+If METHOD is "shell", then gRPCake starts an interactive session against
+TARGET. The session keeps one connection open, and only discovers methods once,
+so commands run quickly:
+
+	$ grpc localhost:50051 shell
+	localhost:50051> set header authorization Bearer ...
+	localhost:50051> call echo.Echo.Echo {"message": "hi"}
+	{"message":"hi"}
+
+Enter "help" for a list of commands. Press Tab to complete commands, method
+names, and JSON field names. Ctrl-C cancels the current call.
+
 gRPCake treats ":" as an alias for "localhost:50051", and ":PORT" as an alias
 for "localhost:PORT", where "PORT" is a decimal number. In all of the examples
 above, you can replace "localhost:50051" with ":" and get the same result.
@@ -112,46 +272,296 @@ If you want to include/exclude headers in/from reflection calls,
 "--reflect-header" and "--rpc-header" (and their "raw" equivalents) are only
 used in reflection and non-reflection RPC calls, respectively.
 
+gRPCake reads defaults for flags from "grpcake/config.toml" in the user config
+directory (e.g. ~/.config), or the file given by "--config". It's a TOML file
+with target aliases, and named profiles of flag values:
+
+	[aliases]
+	staging = "api.staging.example.com:443"
+
+	[profiles.staging]
+	targets = ["staging"]
+	server-root-ca = "certs/staging-ca.crt"
+	header = ["authorization: Bearer ..."]
+
+Aliases work like ":" and ":PORT", so "grpc staging ls" connects to
+"api.staging.example.com:443". A profile is used when TARGET is one of its
+targets, or when it's chosen with "-p" or "--profile". Flags on the command line
+take precedence over the profile, except that headers from both are sent.
+Relative paths in a profile are relative to the config file.
+
+To see what gRPCake is doing, use "-v" or "--verbose". Like curl, gRPCake will
+output lines to stderr about the connection (starting with "*"), what it sends
+to the server (starting with ">"), and what it receives (starting with "<"),
+including the connected address, TLS details, metadata, and message sizes.
+
+By default, gRPCake waits indefinitely for the server. To limit how long the
+whole operation (connecting, reflection, and the RPC itself) may take, use "-m"
+or "--max-time", which also tells the server the RPC's deadline. To only limit
+how long gRPCake waits to connect to the server, use "--connect-timeout". In a
+shell, "--max-time" limits each call instead. Both take a number of seconds,
+which can be fractional:
+
+	grpc --connect-timeout 2 --max-time 10.5 ...
+
+If an RPC fails, gRPCake exits with a status derived from the RPC's gRPC status
+code. Other errors, such as invalid input, exit with status 1.
+
+	Status code           Exit status
+	Canceled              65
+	Unknown               66
+	InvalidArgument       67
+	DeadlineExceeded      68
+	NotFound              69
+	AlreadyExists         70
+	PermissionDenied      71
+	ResourceExhausted     72
+	FailedPrecondition    73
+	Aborted               74
+	OutOfRange            75
+	Unimplemented         76
+	Internal              77
+	Unavailable           78
+	DataLoss              79
+	Unauthenticated       80
+
+If the server includes error details (e.g. "google.rpc.BadRequest") in a failed
+RPC's status, gRPCake outputs each of them to stderr as JSON. Standard error
+detail types are built into gRPCake; custom types are looked up the same way as
+methods are.
+
+To output RPC errors to stderr as JSON, including the status code, message, and
+any error details, use "--error-format json".
+
+By default, gRPCake outputs each message as a single line of JSON, omitting
+fields with default values (e.g. zero, empty string, or false), as is standard
+for Protobuf's JSON encoding. To customize output, use:
+
+	--pretty             output indented, multi-line JSON
+	--indent STRING      indent output with STRING instead (implies --pretty)
+	--emit-defaults      output fields with default values too
+	--use-proto-names    output field names as they appear in the .proto file,
+	                     e.g. "foo_bar" instead of "fooBar"
+	--enums-as-ints      output enum values as numbers instead of names
+
+Input may use either style of field name. To ignore fields in input that
+METHOD's input type doesn't have, instead of failing, use "--discard-unknown"
+(or its alias, "--allow-unknown-fields").
+
+gRPCake reads and writes JSON by default. To use another encoding for input or
+output, use "--in" or "--out", respectively, with one of:
+
+	json      Protobuf's standard JSON encoding; the default
+	yaml      (input only) the same as json, but written as YAML; in streams,
+	          messages are separate documents, separated by "---"
+	text      Protobuf text format; in streams, messages are separated by
+	          lines containing only "---"
+	binary    Protobuf binary wire format, with each message prefixed by its
+	          length as a varint (i.e. "length-delimited")
+	base64    Protobuf binary wire format, base64-encoded, one message per line
+
+For example, to convert a base64-encoded message from a log into JSON:
+
+	echo 'CgJoaQ==' | grpc --in base64 : echo.Echo.Echo
+
+To fill in input when gRPCake runs, use "--template-vars". Then, in input
+messages and header values, "${NAME}" is replaced with the environment variable
+NAME, and these expressions are evaluated:
+
+	{{uuid}}              a random UUID
+	{{now}}               the current time, in RFC 3339 format
+	{{randInt MIN MAX}}   a random integer from MIN to MAX, inclusive
+	{{file "NAME"}}       the contents of a file, without trailing newlines
+
+For example:
+
+	grpc --template-vars : echo.Echo.Echo -d '{"message": "${USER} {{uuid}}"}'
+
+Values are inserted as-is, and expressions can't span lines. With "bench",
+templates are expanded again for each call.
+
+"--out text" is always multi-line, but "--indent" applies to it too. The other
+output options above only apply to JSON.
+
 To output server response headers and trailers, use "--dump-header" and
 "--dump-trailer".
+
+To output everything about an RPC as a single JSON document on stdout, use
+"--envelope". The document contains the response headers, each response message
+along with the time it was received, the trailers, the final status, and the
+duration of the RPC in seconds:
+
+	$ grpc --envelope localhost:50051 echo.Echo.Echo -d '{"message": "hi"}'
+	{"header":{...},"messages":[{"index":0,"time":"...","message":{"message":"hi"}}],"trailer":{...},"status":{"code":0,"name":"OK","message":""},"duration":0.0012}
+
+The envelope is output even if the RPC fails. "--envelope" only supports JSON
+output.
 `)
 }
 
 func main() {
 	cli.Run(context.Background(), func(ctx context.Context, args args) error {
-		args.populateDefaults()
-
-		cc, err := dial(ctx, args)
-		if err != nil {
+		// the config is applied here rather than in run, so that errors are
+		// printed with the profile's --error-format too
+		if err := args.resolve(); err != nil {
 			return err
 		}
 
-		ctxReflect, ctxRPC, err := args.metadataContexts(ctx)
-		if err != nil {
-			return err
+		err := run(ctx, args)
+		if s, ok := rpcStatus(err); ok {
+			// cli.Run always exits with status 1, so exit ourselves so that
+			// scripts can tell different kinds of RPC failures apart
+			printStatusError(args, s, err)
+			os.Exit(statusExitCode(s.Code()))
 		}
 
-		msrc, err := args.methodSource(ctxReflect, cc)
-		if err != nil {
+		return err
+	})
+}
+
+// resolve fills in args from the config file and defaults, ready for run.
+func (args *args) resolve() error {
+	if err := args.applyConfig(); err != nil {
+		return err
+	}
+
+	if args.Method == "export" {
+		if err := args.prepareExport(); err != nil {
 			return err
 		}
+	}
+
+	args.populateDefaults()
+	return nil
+}
+
+func run(ctx context.Context, args args) error {
+	switch args.ErrorFormat {
+	case "", errorFormatText, errorFormatJSON:
+	default:
+		return fmt.Errorf("--error-format: must be %q or %q, got: %q", errorFormatText, errorFormatJSON, args.ErrorFormat)
+	}
+
+	if err := args.validateEncodings(); err != nil {
+		return err
+	}
+
+	// in a shell, --max-time limits each call instead of the whole session;
+	// see (*shell).call
+	if args.MaxTime > 0 && args.Method != "shell" {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, seconds(args.MaxTime))
+		defer cancel()
+	}
+
+	cc, err := dial(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	ctxReflect, ctxRPC, err := args.metadataContexts(ctx)
+	if err != nil {
+		return err
+	}
+
+	msrc, err := args.methodSource(ctxReflect, cc)
+	if err != nil {
+		return err
+	}
+
+	defer msrc.Close()
+
+	args.resolver = newTypeResolver(msrc)
+
+	if args.Method == "ll" {
+		args.Method = "ls"
+		args.Long = true
+	}
+
+	if args.Method == "ls" {
+		return listMethods(msrc, args)
+	}
+
+	if args.Method == "describe" {
+		return describeSymbols(msrc, args)
+	}
+
+	if args.Method == "template" {
+		return printTemplate(msrc, args)
+	}
+
+	if args.Method == "export" {
+		return exportSchema(msrc, args)
+	}
+
+	if args.Method == "bench" {
+		return benchMethod(ctx, cc, msrc, args)
+	}
+
+	if args.Method == "shell" {
+		return runShell(ctxRPC, cc, msrc, args)
+	}
+
+	// decode error details now, while msrc is still open to resolve their types
+	return decodeStatusDetails(msrc, invokeMethod(ctxRPC, cc, msrc, args))
+}
 
-		defer msrc.Close()
+func (args args) Autocomplete_Method() []string {
+	methods := args.autocompleteMethods()
+	if methods == nil {
+		return nil
+	}
 
-		if args.Method == "ll" {
-			args.Method = "ls"
-			args.Long = true
+	out := []string{"ls", "ll", "describe", "template", "bench", "shell", "export"}
+	for _, m := range methods {
+		out = append(out, string(m.FullName()))
+	}
+
+	return out
+}
+
+func (args args) Autocomplete_Symbols() []string {
+	if args.Method == "bench" {
+		var out []string
+		for _, m := range args.autocompleteMethods() {
+			out = append(out, string(m.FullName()))
 		}
 
-		if args.Method == "ls" {
-			return listMethods(msrc, args)
+		return out
+	}
+
+	if args.Method != "describe" && args.Method != "template" && args.Method != "export" {
+		return nil
+	}
+
+	return symbolNames(args.autocompleteMethods())
+}
+
+// symbolNames returns the names of methods, as well as their services and input
+// and output messages, which are what can be passed to describe and template.
+func symbolNames(methods []protoreflect.MethodDescriptor) []string {
+	var out []string
+	seen := map[protoreflect.FullName]bool{}
+	for _, m := range methods {
+		svc := m.Parent().FullName()
+		if !seen[svc] {
+			seen[svc] = true
+			out = append(out, string(svc))
 		}
 
-		return invokeMethod(ctxRPC, cc, msrc, args)
-	})
+		out = append(out, string(m.FullName()), string(m.Input().FullName()), string(m.Output().FullName()))
+	}
+
+	return out
 }
 
-func (args args) Autocomplete_Method() []string {
+// autocompleteMethods returns all methods available from TARGET, or nil if
+// they cannot be determined.
+func (args args) autocompleteMethods() []protoreflect.MethodDescriptor {
+	if err := args.applyConfig(); err != nil {
+		return nil
+	}
+
 	args.populateDefaults()
 	ctx, _, err := args.metadataContexts(context.Background())
 	if err != nil {
@@ -159,7 +569,7 @@ func (args args) Autocomplete_Method() []string {
 	}
 
 	cc, err := dial(context.Background(), args)
-	if len(args.Protoset) == 0 && err != nil {
+	if args.useReflection() && err != nil {
 		// we only need cc if we're using reflection
 		return nil
 	}
@@ -176,12 +586,13 @@ func (args args) Autocomplete_Method() []string {
 		return nil
 	}
 
-	out := []string{"ls", "ll"}
-	for _, m := range methods {
-		out = append(out, string(m.FullName()))
-	}
+	return methods
+}
 
-	return out
+// seconds converts a number of seconds, as accepted by flags like --max-time,
+// into a time.Duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
 
 func (args *args) populateDefaults() {
@@ -192,6 +603,17 @@ func (args *args) populateDefaults() {
 
 // metadataContexts returns contexts to be used for reflection and RPC calls.
 func (args args) metadataContexts(ctx context.Context) (context.Context, context.Context, error) {
+	if args.TemplateVars {
+		for _, headers := range []*[]string{&args.Header, &args.HeaderRawValue, &args.ReflectHeader, &args.ReflectHeaderRawValue, &args.RPCHeader, &args.RPCHeaderRawValue} {
+			expanded, err := expandHeaderTemplateVars(*headers)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			*headers = expanded
+		}
+	}
+
 	md, err := parseHeaders(args.Header, args.HeaderRawKey, args.HeaderRawValue)
 	if err != nil {
 		return nil, nil, fmt.Errorf("--header/--header-raw-key/--header-raw-value: %w", err)
@@ -212,9 +634,120 @@ func (args args) metadataContexts(ctx context.Context) (context.Context, context
 }
 
 func (args args) methodSource(ctx context.Context, cc *grpc.ClientConn) (methodSource, error) {
-	if len(args.Protoset) == 0 {
+	if len(args.Protoset) > 0 && len(args.Proto) > 0 {
+		return nil, fmt.Errorf("--protoset and --proto cannot be used together")
+	}
+
+	if err := validateReflectMode(args.Reflect); err != nil {
+		return nil, err
+	}
+
+	var local methodSource
+	var localName string
+	if len(args.Proto) > 0 {
+		msrc, err := newProtoMethodSource(ctx, args.ImportPath, args.Proto)
+		if err != nil {
+			return nil, err
+		}
+
+		local, localName = msrc, "--proto"
+	}
+
+	if len(args.Protoset) > 0 {
+		msrc, err := newProtosetMethodSource(args.Protoset)
+		if err != nil {
+			return nil, err
+		}
+
+		local, localName = msrc, "--protoset"
+	}
+
+	if local == nil {
+		return args.reflectionMethodSource(ctx, cc)
+	}
+
+	if args.Reflect == "" || args.Reflect == reflectModeAuto {
+		return local, nil
+	}
+
+	r, err := args.reflectionMethodSource(ctx, cc)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCompositeMethodSource(os.Stderr)
+	if args.Reflect == reflectModeFirst {
+		c.add("reflection", r)
+		c.add(localName, local)
+	} else {
+		c.add(localName, local)
+		c.add("reflection", r)
+	}
+
+	return c, nil
+}
+
+func (args args) reflectionMethodSource(ctx context.Context, cc *grpc.ClientConn) (methodSource, error) {
+	if args.NoCache {
 		return newReflectMethodSource(ctx, args, cc)
 	}
 
-	return newProtosetMethodSource(args.Protoset)
+	return newCachedMethodSource(ctx, args, cc)
+}
+
+// marshalMessage encodes msg as JSON for output.
+func (args args) marshalMessage(msg proto.Message) ([]byte, error) {
+	opts := protojson.MarshalOptions{
+		EmitUnpopulated: args.EmitDefaults,
+		UseProtoNames:   args.UseProtoNames,
+		UseEnumNumbers:  args.EnumsAsInts,
+		Resolver:        args.resolver,
+	}
+
+	b, err := opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// protojson deliberately randomizes its whitespace, so that nobody depends
+	// on it; we want stable output, so we do our own formatting
+	return args.formatJSON(b)
+}
+
+// formatJSON reformats b according to --pretty and --indent.
+func (args args) formatJSON(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if args.Pretty || args.Indent != "" {
+		indent := args.Indent
+		if indent == "" {
+			indent = "  "
+		}
+
+		err = json.Indent(&buf, b, "", indent)
+	} else {
+		err = json.Compact(&buf, b)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// unmarshalOptions returns the options to decode JSON input messages with.
+func (args args) unmarshalOptions() protojson.UnmarshalOptions {
+	return protojson.UnmarshalOptions{DiscardUnknown: args.discardUnknown(), Resolver: args.resolver}
+}
+
+// discardUnknown returns whether to ignore unknown fields in input messages.
+func (args args) discardUnknown() bool {
+	return args.DiscardUnknown || args.AllowUnknownFields
+}
+
+// useReflection returns whether methods are discovered using reflection, as
+// opposed to only from local schema files.
+func (args args) useReflection() bool {
+	return len(args.Protoset) == 0 && len(args.Proto) == 0 || args.Reflect == reflectModeFirst || args.Reflect == reflectModeLast
 }
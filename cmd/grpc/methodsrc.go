@@ -5,5 +5,7 @@ import "google.golang.org/protobuf/reflect/protoreflect"
 type methodSource interface {
 	Methods() ([]protoreflect.MethodDescriptor, error)
 	Method(protoreflect.FullName) (protoreflect.MethodDescriptor, error)
+	Descriptor(protoreflect.FullName) (protoreflect.Descriptor, error)
+	Extension(message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error)
 	Close() error
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// newProtoMethodSource parses .proto source files in-process. Like a
+// .protoset, the result is just a file registry, so it shares
+// protosetMethodSource's implementation.
+func newProtoMethodSource(ctx context.Context, importPaths, protos []string) (protosetMethodSource, error) {
+	var names []string
+	for _, p := range protos {
+		names = append(names, protoImportName(importPaths, p))
+	}
+
+	compiler := protocompile.Compiler{
+		// the standard imports (e.g. google/protobuf/empty.proto) are bundled
+		// into the binary, so users don't need them on their import path
+		Resolver:       protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+
+	files, err := compiler.Compile(ctx, names...)
+	if err != nil {
+		return protosetMethodSource{}, fmt.Errorf("compile .proto files: %w", err)
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	seen := map[string]bool{}
+	for _, f := range files {
+		addFileWithImports(&fds, seen, f)
+	}
+
+	reg, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		return protosetMethodSource{}, fmt.Errorf("create file registry: %w", err)
+	}
+
+	return protosetMethodSource{reg: reg}, nil
+}
+
+// protoImportName converts a path to a .proto file into the name it would be
+// imported by, the same way protoc does: relative to the first import path
+// that contains it. Paths outside of every import path are assumed to already
+// be import names, e.g. "foo.proto" with "-I protos".
+func protoImportName(importPaths []string, path string) string {
+	for _, importPath := range importPaths {
+		rel, err := filepath.Rel(importPath, path)
+		if err != nil {
+			continue
+		}
+
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+
+	return filepath.ToSlash(path)
+}
+
+func addFileWithImports(fds *descriptorpb.FileDescriptorSet, seen map[string]bool, fd protoreflect.FileDescriptor) {
+	if seen[fd.Path()] {
+		return
+	}
+
+	seen[fd.Path()] = true
+
+	imports := fd.Imports()
+	for i, l := 0, imports.Len(); i < l; i++ {
+		addFileWithImports(fds, seen, imports.Get(i).FileDescriptor)
+	}
+
+	fds.File = append(fds.File, protodesc.ToFileDescriptorProto(fd))
+}
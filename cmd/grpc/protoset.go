@@ -18,6 +18,11 @@ type protosetMethodSource struct {
 
 func newProtosetMethodSource(protosets []string) (protosetMethodSource, error) {
 	var fds descriptorpb.FileDescriptorSet
+
+	// protosets built with --include_imports often share imports, which is
+	// fine as long as they agree on what's in them
+	fileProtosets := map[string]string{}
+	files := map[string]*descriptorpb.FileDescriptorProto{}
 	for _, p := range protosets {
 		f, err := os.Open(p)
 		if err != nil {
@@ -34,7 +39,19 @@ func newProtosetMethodSource(protosets []string) (protosetMethodSource, error) {
 			return protosetMethodSource{}, fmt.Errorf("unmarshal %s: %w", p, err)
 		}
 
-		fds.File = append(fds.File, subFDS.File...)
+		for _, f := range subFDS.File {
+			if prev, ok := files[f.GetName()]; ok {
+				if !sameFile(prev, f) {
+					return protosetMethodSource{}, fmt.Errorf("%s and %s both define %s, differently", fileProtosets[f.GetName()], p, f.GetName())
+				}
+
+				continue
+			}
+
+			fileProtosets[f.GetName()] = p
+			files[f.GetName()] = f
+			fds.File = append(fds.File, f)
+		}
 	}
 
 	reg, err := protodesc.NewFiles(&fds)
@@ -68,9 +85,66 @@ func (p protosetMethodSource) Method(name protoreflect.FullName) (protoreflect.M
 		return nil, err
 	}
 
-	return d.(protoreflect.MethodDescriptor), nil
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+
+	return md, nil
+}
+
+func (p protosetMethodSource) Descriptor(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return p.reg.FindDescriptorByName(name)
+}
+
+func (p protosetMethodSource) Extension(message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error) {
+	return findExtension(p.reg, message, number)
+}
+
+func (p protosetMethodSource) loadedFile(path string) *descriptorpb.FileDescriptorProto {
+	fd, err := p.reg.FindFileByPath(path)
+	if err != nil {
+		return nil
+	}
+
+	return protodesc.ToFileDescriptorProto(fd)
 }
 
 func (p protosetMethodSource) Close() error {
 	return nil
 }
+
+// findExtension returns the extension of message with the given number from
+// the files in reg.
+func findExtension(reg *protoregistry.Files, message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error) {
+	var found protoreflect.FieldDescriptor
+	reg.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		found = findExtensionIn(fd.Extensions(), fd.Messages(), message, number)
+		return found == nil
+	})
+
+	if found == nil {
+		return nil, protoregistry.NotFound
+	}
+
+	return found, nil
+}
+
+// findExtensionIn returns the extension of message with the given number from
+// exts, or from the extensions declared in msgs, including nested ones.
+func findExtensionIn(exts protoreflect.ExtensionDescriptors, msgs protoreflect.MessageDescriptors, message protoreflect.FullName, number protoreflect.FieldNumber) protoreflect.FieldDescriptor {
+	for i, l := 0, exts.Len(); i < l; i++ {
+		if xd := exts.Get(i); xd.Number() == number && xd.ContainingMessage().FullName() == message {
+			return xd
+		}
+	}
+
+	for i, l := 0, msgs.Len(); i < l; i++ {
+		md := msgs.Get(i)
+		if xd := findExtensionIn(md.Extensions(), md.Messages(), message, number); xd != nil {
+			return xd
+		}
+	}
+
+	return nil
+}
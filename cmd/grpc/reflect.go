@@ -3,136 +3,402 @@ package main
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 )
 
+const (
+	reflectVersionAuto    = "auto"
+	reflectVersionV1      = "v1"
+	reflectVersionV1Alpha = "v1alpha"
+)
+
+// reflectServices maps reflection API versions to their service names. The
+// v1 and v1alpha messages are identical on the wire, so we always speak v1
+// messages and only vary which service we send them to.
+var reflectServices = map[string]string{
+	reflectVersionV1:      "grpc.reflection.v1.ServerReflection",
+	reflectVersionV1Alpha: "grpc.reflection.v1alpha.ServerReflection",
+}
+
 type reflectMethodSource struct {
-	client grpc_reflection_v1alpha.ServerReflection_ServerReflectionInfoClient
+	ctx    context.Context
+	args   args
+	cc     *grpc.ClientConn
+	opts   []grpc.CallOption
+	client grpc.ClientStream
+	files  map[string]*descriptorpb.FileDescriptorProto
+
+	// extensionNumbers caches the extension numbers the server knows of for
+	// each message type, or nil if it couldn't say
+	extensionNumbers map[protoreflect.FullName]map[protoreflect.FieldNumber]bool
+
+	// fallback is true if we are using v1, but may still fall back to v1alpha
+	// if the server turns out to not implement v1.
+	fallback bool
+}
+
+func newReflectMethodSource(ctx context.Context, args args, cc *grpc.ClientConn, opts ...grpc.CallOption) (*reflectMethodSource, error) {
+	r := &reflectMethodSource{
+		ctx:   ctx,
+		args:  args,
+		cc:    cc,
+		opts:  opts,
+		files: map[string]*descriptorpb.FileDescriptorProto{},
+
+		extensionNumbers: map[protoreflect.FullName]map[protoreflect.FieldNumber]bool{},
+	}
+
+	if err := validateReflectVersion(args.ReflectVersion); err != nil {
+		return nil, err
+	}
+
+	version := args.ReflectVersion
+	if version == "" || version == reflectVersionAuto {
+		version = reflectVersionV1
+		r.fallback = true
+	}
+
+	if err := r.open(version); err != nil {
+		return nil, err
+	}
+
+	return r, nil
 }
 
-func newReflectMethodSource(ctx context.Context, args args, cc *grpc.ClientConn, opts ...grpc.CallOption) (reflectMethodSource, error) {
-	client, err := grpc_reflection_v1alpha.NewServerReflectionClient(cc).ServerReflectionInfo(ctx, opts...)
+func validateReflectVersion(version string) error {
+	switch version {
+	case "", reflectVersionAuto, reflectVersionV1, reflectVersionV1Alpha:
+		return nil
+	default:
+		return fmt.Errorf("--reflect-version: must be one of %q, %q, or %q, got: %q", reflectVersionAuto, reflectVersionV1, reflectVersionV1Alpha, version)
+	}
+}
+
+func (r *reflectMethodSource) open(version string) error {
+	desc := grpc_reflection_v1.ServerReflection_ServiceDesc.Streams[0]
+	client, err := r.cc.NewStream(r.ctx, &desc, "/"+reflectServices[version]+"/"+desc.StreamName, r.opts...)
 	if err != nil {
-		return reflectMethodSource{}, humanizeConnErr(args, err)
+		return humanizeConnErr(r.args, err)
+	}
+
+	r.client = client
+	return nil
+}
+
+// roundTrip sends req and returns the server's response to it. If the server
+// doesn't implement v1 reflection, roundTrip transparently retries using
+// v1alpha when permitted by --reflect-version.
+func (r *reflectMethodSource) roundTrip(req *grpc_reflection_v1.ServerReflectionRequest) (*grpc_reflection_v1.ServerReflectionResponse, error) {
+	res, err := r.sendRecv(req)
+	if r.fallback && status.Code(err) == codes.Unimplemented {
+		r.fallback = false
+		_ = r.client.CloseSend()
+
+		if err := r.open(reflectVersionV1Alpha); err != nil {
+			return nil, err
+		}
+
+		return r.sendRecv(req)
 	}
 
-	return reflectMethodSource{client: client}, err
+	// only the first round trip can tell us which version the server supports
+	r.fallback = false
+	return res, err
 }
 
-func (r reflectMethodSource) Methods() ([]protoreflect.MethodDescriptor, error) {
-	if err := r.client.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
-		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_ListServices{},
-	}); err != nil {
-		return nil, fmt.Errorf("send ListServices: %w", err)
+func (r *reflectMethodSource) sendRecv(req *grpc_reflection_v1.ServerReflectionRequest) (*grpc_reflection_v1.ServerReflectionResponse, error) {
+	// if the server rejects the stream, SendMsg returns io.EOF and the actual
+	// status is only available from RecvMsg, so we ignore send errors here
+	_ = r.client.SendMsg(req)
+
+	var res grpc_reflection_v1.ServerReflectionResponse
+	if err := r.client.RecvMsg(&res); err != nil {
+		return nil, humanizeConnErr(r.args, err)
 	}
 
-	res, err := r.client.Recv()
+	return &res, nil
+}
+
+func (r *reflectMethodSource) Methods() ([]protoreflect.MethodDescriptor, error) {
+	res, err := r.roundTrip(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_ListServices{},
+	})
 	if err != nil {
 		return nil, fmt.Errorf("recv ListServices: %w (does the server have gRPC reflection enabled?)", err)
 	}
 
-	var svcs []string
-	var fds descriptorpb.FileDescriptorSet
-	listSvcRes := res.MessageResponse.(*grpc_reflection_v1alpha.ServerReflectionResponse_ListServicesResponse)
+	if err, ok := res.MessageResponse.(*grpc_reflection_v1.ServerReflectionResponse_ErrorResponse); ok {
+		return nil, fmt.Errorf("reflection: code: %v: %v", err.ErrorResponse.ErrorCode, err.ErrorResponse.ErrorMessage)
+	}
+
+	var svcs []protoreflect.FullName
+	listSvcRes := res.MessageResponse.(*grpc_reflection_v1.ServerReflectionResponse_ListServicesResponse)
 	for _, svc := range listSvcRes.ListServicesResponse.Service {
-		svcs = append(svcs, svc.Name)
+		name := protoreflect.FullName(svc.Name)
+		svcs = append(svcs, name)
 
-		if err := r.client.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
-			MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{
-				FileContainingSymbol: svc.Name,
-			},
-		}); err != nil {
-			return nil, fmt.Errorf("send FileContainingSymbol: %w", err)
+		// many services share files, so only fetch files we haven't seen yet
+		if r.hasService(name) {
+			continue
 		}
 
-		res, err := r.client.Recv()
+		if err := r.fileContainingSymbol(name); err != nil {
+			return nil, err
+		}
+	}
+
+	reg, err := r.registry()
+	if err != nil {
+		return nil, err
+	}
+
+	var mds []protoreflect.MethodDescriptor
+	for _, name := range svcs {
+		d, err := reg.FindDescriptorByName(name)
 		if err != nil {
-			return nil, fmt.Errorf("recv FileContainingSymbol: %w", err)
+			return nil, fmt.Errorf("find service %s: %w", name, err)
 		}
 
-		fdRes := res.MessageResponse.(*grpc_reflection_v1alpha.ServerReflectionResponse_FileDescriptorResponse)
-		files := fdRes.FileDescriptorResponse.FileDescriptorProto
-		for _, f := range files {
-			var fd descriptorpb.FileDescriptorProto
-			if err := proto.Unmarshal(f, &fd); err != nil {
-				return nil, fmt.Errorf("unmarshal FileDescriptorProto: %w", err)
-			}
+		svc, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a service", name)
+		}
 
-			fds.File = append(fds.File, &fd)
+		methods := svc.Methods()
+		for i, l := 0, methods.Len(); i < l; i++ {
+			mds = append(mds, methods.Get(i))
 		}
 	}
 
-	reg, err := protodesc.NewFiles(&fds)
+	return mds, nil
+}
+
+func (r *reflectMethodSource) Method(name protoreflect.FullName) (protoreflect.MethodDescriptor, error) {
+	d, err := r.Descriptor(name)
 	if err != nil {
-		return nil, fmt.Errorf("create file registry: %w", err)
+		return nil, err
 	}
 
-	var mds []protoreflect.MethodDescriptor
-	reg.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
-		svcs := fd.Services()
-		for i, l := 0, svcs.Len(); i < l; i++ {
-			methods := svcs.Get(i).Methods()
-			for i, l := 0, methods.Len(); i < l; i++ {
-				mds = append(mds, methods.Get(i))
-			}
-		}
+	md, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a method", name)
+	}
+
+	return md, nil
+}
+
+func (r *reflectMethodSource) Descriptor(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if err := r.fileContainingSymbol(name); err != nil {
+		return nil, err
+	}
 
-		return true
+	reg, err := r.registry()
+	if err != nil {
+		return nil, err
+	}
+
+	return reg.FindDescriptorByName(name)
+}
+
+func (r *reflectMethodSource) Extension(message protoreflect.FullName, number protoreflect.FieldNumber) (protoreflect.FieldDescriptor, error) {
+	// listing message's extension numbers takes one round trip per message
+	// type, and saves one for every unknown field that isn't an extension
+	if numbers, ok := r.allExtensionNumbersOfType(message); ok && !numbers[number] {
+		return nil, protoregistry.NotFound
+	}
+
+	res, err := r.roundTrip(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileContainingExtension{
+			FileContainingExtension: &grpc_reflection_v1.ExtensionRequest{
+				ContainingType:  string(message),
+				ExtensionNumber: int32(number),
+			},
+		},
 	})
+	if err != nil {
+		return nil, fmt.Errorf("recv FileContainingExtension: %w", err)
+	}
 
-	return mds, nil
+	if err := r.addFiles(res); err != nil {
+		return nil, fmt.Errorf("FileContainingExtension %s %d: %w", message, number, err)
+	}
+
+	if err := r.resolveDependencies(); err != nil {
+		return nil, err
+	}
+
+	reg, err := r.registry()
+	if err != nil {
+		return nil, err
+	}
+
+	return findExtension(reg, message, number)
 }
 
-func (r reflectMethodSource) Method(name protoreflect.FullName) (protoreflect.MethodDescriptor, error) {
-	if err := r.client.Send(&grpc_reflection_v1alpha.ServerReflectionRequest{
-		MessageRequest: &grpc_reflection_v1alpha.ServerReflectionRequest_FileContainingSymbol{
-			FileContainingSymbol: string(name),
+// allExtensionNumbersOfType returns the numbers of the extensions of message
+// that the server knows of, or false if the server can't say.
+func (r *reflectMethodSource) allExtensionNumbersOfType(message protoreflect.FullName) (map[protoreflect.FieldNumber]bool, bool) {
+	if numbers, ok := r.extensionNumbers[message]; ok {
+		return numbers, numbers != nil
+	}
+
+	var numbers map[protoreflect.FieldNumber]bool
+	res, err := r.roundTrip(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_AllExtensionNumbersOfType{
+			AllExtensionNumbersOfType: string(message),
 		},
-	}); err != nil {
-		return nil, fmt.Errorf("send FileContainingSymbol: %w", err)
+	})
+	if err == nil {
+		if numRes, ok := res.MessageResponse.(*grpc_reflection_v1.ServerReflectionResponse_AllExtensionNumbersResponse); ok {
+			numbers = map[protoreflect.FieldNumber]bool{}
+			for _, n := range numRes.AllExtensionNumbersResponse.ExtensionNumber {
+				numbers[protoreflect.FieldNumber(n)] = true
+			}
+		}
 	}
 
-	res, err := r.client.Recv()
+	r.extensionNumbers[message] = numbers
+	return numbers, numbers != nil
+}
+
+// fileContainingSymbol fetches the file declaring name, along with all of that
+// file's transitive dependencies.
+func (r *reflectMethodSource) fileContainingSymbol(name protoreflect.FullName) error {
+	res, err := r.roundTrip(&grpc_reflection_v1.ServerReflectionRequest{
+		MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileContainingSymbol{
+			FileContainingSymbol: string(name),
+		},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("recv FileContainingSymbol: %w", err)
+		return fmt.Errorf("recv FileContainingSymbol: %w", err)
 	}
 
-	if err, ok := res.MessageResponse.(*grpc_reflection_v1alpha.ServerReflectionResponse_ErrorResponse); ok {
-		return nil, fmt.Errorf("reflection: code: %v: %v", err.ErrorResponse.ErrorCode, err.ErrorResponse.ErrorMessage)
+	if err := r.addFiles(res); err != nil {
+		return fmt.Errorf("FileContainingSymbol %s: %w", name, err)
 	}
 
-	fdRes := res.MessageResponse.(*grpc_reflection_v1alpha.ServerReflectionResponse_FileDescriptorResponse)
-	files := fdRes.FileDescriptorResponse.FileDescriptorProto
-	var fds descriptorpb.FileDescriptorSet
-	for _, f := range files {
+	return r.resolveDependencies()
+}
+
+// resolveDependencies fetches, by name, any dependencies of already-fetched
+// files that the server did not already send us.
+//
+// Servers are allowed to omit files they have sent earlier in the same stream,
+// so we can't assume any single response is complete.
+func (r *reflectMethodSource) resolveDependencies() error {
+	for {
+		var missing []string
+		for _, fd := range r.files {
+			for _, dep := range fd.Dependency {
+				if _, ok := r.files[dep]; !ok {
+					missing = append(missing, dep)
+				}
+			}
+		}
+
+		if len(missing) == 0 {
+			return nil
+		}
+
+		for _, name := range missing {
+			// an earlier response in this loop may have included this file
+			if _, ok := r.files[name]; ok {
+				continue
+			}
+
+			res, err := r.roundTrip(&grpc_reflection_v1.ServerReflectionRequest{
+				MessageRequest: &grpc_reflection_v1.ServerReflectionRequest_FileByFilename{
+					FileByFilename: name,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("recv FileByFilename: %w", err)
+			}
+
+			if err := r.addFiles(res); err != nil {
+				return fmt.Errorf("FileByFilename %s: %w", name, err)
+			}
+
+			if _, ok := r.files[name]; !ok {
+				return fmt.Errorf("FileByFilename %s: server did not return requested file", name)
+			}
+		}
+	}
+}
+
+// addFiles adds the files in a FileDescriptorResponse to r.files.
+func (r *reflectMethodSource) addFiles(res *grpc_reflection_v1.ServerReflectionResponse) error {
+	if err, ok := res.MessageResponse.(*grpc_reflection_v1.ServerReflectionResponse_ErrorResponse); ok {
+		return fmt.Errorf("reflection: code: %v: %v", err.ErrorResponse.ErrorCode, err.ErrorResponse.ErrorMessage)
+	}
+
+	fdRes, ok := res.MessageResponse.(*grpc_reflection_v1.ServerReflectionResponse_FileDescriptorResponse)
+	if !ok {
+		return fmt.Errorf("unexpected reflection response: %T", res.MessageResponse)
+	}
+
+	for _, f := range fdRes.FileDescriptorResponse.FileDescriptorProto {
 		var fd descriptorpb.FileDescriptorProto
 		if err := proto.Unmarshal(f, &fd); err != nil {
-			return nil, err
+			return fmt.Errorf("unmarshal FileDescriptorProto: %w", err)
 		}
 
-		fds.File = append(fds.File, &fd)
+		r.files[fd.GetName()] = &fd
 	}
 
-	reg, err := protodesc.NewFiles(&fds)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// hasService returns whether a fetched file declares the service name.
+func (r *reflectMethodSource) hasService(name protoreflect.FullName) bool {
+	for _, fd := range r.files {
+		for _, svc := range fd.Service {
+			if protoreflect.FullName(fd.GetPackage()).Append(protoreflect.Name(svc.GetName())) == name {
+				return true
+			}
+		}
 	}
 
-	d, err := reg.FindDescriptorByName(name)
+	return false
+}
+
+// registry returns a registry of all files fetched so far.
+func (r *reflectMethodSource) registry() (*protoregistry.Files, error) {
+	var names []string
+	for name := range r.files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var fds descriptorpb.FileDescriptorSet
+	for _, name := range names {
+		fds.File = append(fds.File, r.files[name])
+	}
+
+	reg, err := protodesc.NewFiles(&fds)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("create file registry: %w", err)
 	}
 
-	return d.(protoreflect.MethodDescriptor), nil
+	return reg, nil
+}
+
+func (r *reflectMethodSource) loadedFile(path string) *descriptorpb.FileDescriptorProto {
+	return r.files[path]
 }
 
-func (r reflectMethodSource) Close() error {
+func (r *reflectMethodSource) Close() error {
 	return r.client.CloseSend()
 }
 
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startEchoServer builds and starts the echo server with args, listening on a
+// unix socket, and returns a target for it. The server is stopped when the
+// test finishes.
+func startEchoServer(t *testing.T, args ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "echoserver")
+	build := exec.Command("go", "build", "-o", bin, "github.com/grpcrud/grpcake/internal/echoserver")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build echoserver: %v\n%s", err, out)
+	}
+
+	sock := filepath.Join(dir, "echo.sock")
+	cmd := exec.Command(bin, append([]string{"-network", "unix", "-addr", sock, "-insecure"}, args...)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start echoserver: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	for start := time.Now(); time.Since(start) < 10*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(sock); err == nil {
+			return "unix://" + sock
+		}
+	}
+
+	t.Fatalf("echoserver did not start listening on %s", sock)
+	return ""
+}
+
+func TestReflectVersions(t *testing.T) {
+	tests := []struct {
+		server string
+		client string
+	}{
+		{server: "v1", client: reflectVersionAuto},
+		{server: "v1alpha", client: reflectVersionAuto},
+		{server: "v1", client: reflectVersionV1},
+		{server: "v1alpha", client: reflectVersionV1Alpha},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.server+"/"+tt.client, func(t *testing.T) {
+			target := startEchoServer(t, "-reflection", "-reflection-version", tt.server)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			args := args{Target: target, Insecure: true, ReflectVersion: tt.client}
+			cc, err := dial(ctx, args)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+
+			defer cc.Close()
+
+			r, err := newReflectMethodSource(ctx, args, cc)
+			if err != nil {
+				t.Fatalf("newReflectMethodSource: %v", err)
+			}
+
+			defer r.Close()
+
+			// this is what ls lists
+			methods, err := r.Methods()
+			if err != nil {
+				t.Fatalf("Methods: %v", err)
+			}
+
+			var found bool
+			for _, m := range methods {
+				if m.FullName() == "echo.Echo.Echo" {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Errorf("Methods: echo.Echo.Echo not listed, got %d methods", len(methods))
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const replHelp = `Enter messages to send them. Commands:
+  .close    half-close the stream, i.e. stop sending messages (or press Ctrl-D)
+  .cancel   cancel the RPC (or press Ctrl-C)
+  .headers  show the response headers
+  .help     show this message`
+
+const (
+	replPrompt             = "> "
+	replContinuationPrompt = ". "
+)
+
+// replTerminal is a terminal for --interactive mode. Output written to it is
+// printed above the line being edited, so it can be written to concurrently
+// with input being read.
+type replTerminal struct {
+	*term.Terminal
+	keys    <-chan byte
+	restore func()
+}
+
+// newREPLTerminal puts stdin into raw mode, so that it can be used for line
+// editing. Call restore to return stdin to its original mode.
+func newREPLTerminal() (*replTerminal, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("--interactive: stdin must be a terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("--interactive: %w", err)
+	}
+
+	var once sync.Once
+	in := &replKeyReader{r: os.Stdin, keys: make(chan byte, 1)}
+	t := &replTerminal{
+		Terminal: term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{in, os.Stdout}, replPrompt),
+		keys:    in.keys,
+		restore: func() { once.Do(func() { _ = term.Restore(fd, state) }) },
+	}
+
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		_ = t.SetSize(width, height)
+	}
+
+	return t, nil
+}
+
+func (t *replTerminal) printf(format string, a ...interface{}) {
+	_, _ = fmt.Fprintf(t, format+"\n", a...)
+}
+
+// replKeyReader intercepts Ctrl-C and Ctrl-D before they reach the terminal.
+// term.Terminal reports both as io.EOF, but we handle them differently, and
+// want to keep reading input after either.
+type replKeyReader struct {
+	r    io.Reader
+	keys chan byte
+}
+
+const (
+	keyCtrlC = 0x03
+	keyCtrlD = 0x04
+)
+
+func (r *replKeyReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != keyCtrlC && b != keyCtrlD {
+			out = append(out, b)
+			continue
+		}
+
+		select {
+		case r.keys <- b:
+		default:
+			// a previous key hasn't been handled yet, so this one is moot
+		}
+	}
+
+	return len(out), err
+}
+
+// replHeader holds response headers, once they've been received.
+type replHeader struct {
+	mu     sync.Mutex
+	header metadata.MD
+}
+
+func (h *replHeader) set(md metadata.MD) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header = md
+}
+
+func (h *replHeader) get() metadata.MD {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.header
+}
+
+type replLine struct {
+	line string
+	err  error
+}
+
+// runREPL sends messages entered into t to stream, until the RPC ends or the
+// user closes the stream. done is closed when the server ends the RPC.
+func runREPL(ctx context.Context, cancel context.CancelFunc, t *replTerminal, stream grpc.ClientStream, method protoreflect.MethodDescriptor, args args, header *replHeader, done <-chan struct{}) error {
+	t.printf("Sending messages to %s. Enter .help for help.", method.FullName())
+
+	// like with readMessages, reading input can block indefinitely, so read
+	// in the background. Lines are only read on request, so that the prompt
+	// can be changed between lines.
+	next := make(chan struct{}, 1)
+	lines := make(chan replLine)
+	go func() {
+		for range next {
+			line, err := t.ReadLine()
+			lines <- replLine{line, err}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	reading := false
+
+	var closed bool
+	closeSend := func() error {
+		if closed {
+			t.printf("The stream is already closed.")
+			return nil
+		}
+
+		closed = true
+		t.printf("Closed the stream. Waiting for the server to end the RPC; enter .cancel to stop waiting.")
+		return stream.CloseSend()
+	}
+
+	var sendErr error
+	send := func(msg proto.Message) error {
+		sendErr = stream.SendMsg(msg)
+		return sendErr
+	}
+
+	var pending strings.Builder
+	for {
+		if !reading {
+			next <- struct{}{}
+			reading = true
+		}
+
+		var l replLine
+		select {
+		case l = <-lines:
+			reading = false
+		case key := <-t.keys:
+			if key == keyCtrlC {
+				cancel()
+				return nil
+			}
+
+			if err := closeSend(); err != nil {
+				return err
+			}
+
+			continue
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+
+		// pasted lines are reported with an error, but are otherwise normal
+		if l.err != nil && l.err != term.ErrPasteIndicator {
+			return fmt.Errorf("--interactive: %w", l.err)
+		}
+
+		if pending.Len() == 0 && strings.HasPrefix(strings.TrimSpace(l.line), ".") {
+			switch cmd := strings.TrimSpace(l.line); cmd {
+			case ".close":
+				if err := closeSend(); err != nil {
+					return err
+				}
+			case ".cancel":
+				cancel()
+				return nil
+			case ".headers":
+				md := header.get()
+				if md == nil {
+					t.printf("No headers received yet.")
+					continue
+				}
+
+				b, _ := json.Marshal(headerTrailer{Header: md})
+				t.printf("%s", b)
+			case ".help":
+				t.printf("%s", replHelp)
+			default:
+				t.printf("Unknown command %q. Enter .help for help.", cmd)
+			}
+
+			continue
+		}
+
+		if closed {
+			t.printf("The stream is closed, so no more messages can be sent.")
+			continue
+		}
+
+		// JSON messages can span multiple lines, so wait for the rest
+		pending.WriteString(l.line + "\n")
+		if (args.In == "" || args.In == encodingJSON) && jsonIncomplete(pending.String()) {
+			t.SetPrompt(replContinuationPrompt)
+			continue
+		}
+
+		t.SetPrompt(replPrompt)
+		input := pending.String()
+		pending.Reset()
+
+		if err := readMessages(ctx, method, args, strings.NewReader(input), send); err != nil {
+			if sendErr != nil {
+				// the RPC is over; the receiving side will report why
+				return nil
+			}
+
+			t.printf("%v", err)
+		}
+	}
+}
+
+// jsonIncomplete returns whether s is a sequence of JSON values, the last of
+// which is cut off.
+func jsonIncomplete(s string) bool {
+	dec := json.NewDecoder(strings.NewReader(s))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err == io.ErrUnexpectedEOF
+		}
+	}
+}
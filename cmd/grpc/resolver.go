@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	// register the standard error detail types (google.rpc.BadRequest, etc.)
+	// in protoregistry.GlobalTypes, so they can be decoded without a schema
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// typeResolver resolves message types by name, for google.protobuf.Any values,
+// and extensions by name or number. Types linked into the binary, such as the
+// well-known types and standard error details, are resolved directly; all
+// others are looked up in msrc, which for reflection means asking the server
+// for the file declaring them.
+type typeResolver struct {
+	msrc methodSource
+
+	// mu guards msrc, which concurrently sent and received messages may need
+	// at the same time, and the caches of types looked up in msrc so far
+	mu    sync.Mutex
+	types map[protoreflect.FullName]protoreflect.MessageType
+
+	// extensions caches extensions by name, and extensionNumbers caches them
+	// by message and number; a nil type means there's no such extension
+	extensions       map[protoreflect.FullName]protoreflect.ExtensionType
+	extensionNumbers map[extensionNumber]protoreflect.ExtensionType
+}
+
+type extensionNumber struct {
+	message protoreflect.FullName
+	number  protoreflect.FieldNumber
+}
+
+func newTypeResolver(msrc methodSource) *typeResolver {
+	return &typeResolver{
+		msrc:             msrc,
+		types:            map[protoreflect.FullName]protoreflect.MessageType{},
+		extensions:       map[protoreflect.FullName]protoreflect.ExtensionType{},
+		extensionNumbers: map[extensionNumber]protoreflect.ExtensionType{},
+	}
+}
+
+func (t *typeResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return mt, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if mt, ok := t.types[name]; ok {
+		return mt, nil
+	}
+
+	d, err := t.msrc.Descriptor(name)
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+
+	mt := dynamicpb.NewMessageType(md)
+	t.types[name] = mt
+	return mt, nil
+}
+
+func (t *typeResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	// type URLs are of the form "example.com/path/to/full.Name"
+	name := url
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		name = url[i+1:]
+	}
+
+	return t.FindMessageByName(protoreflect.FullName(name))
+}
+
+func (t *typeResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByName(field); err == nil {
+		return xt, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if xt, ok := t.extensions[field]; ok {
+		return xt, nil
+	}
+
+	d, err := t.msrc.Descriptor(field)
+	if err != nil {
+		return nil, err
+	}
+
+	xd, ok := d.(protoreflect.FieldDescriptor)
+	if !ok || !xd.IsExtension() {
+		return nil, fmt.Errorf("%s is not an extension", field)
+	}
+
+	return t.addExtension(xd), nil
+}
+
+// FindExtensionByNumber is used while decoding messages, to parse fields that
+// aren't in the message's schema. Most such fields simply aren't extensions,
+// so failures are cached, and returned as protoregistry.NotFound, which is
+// what tells the decoder to keep them as unknown fields.
+func (t *typeResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	if xt, err := protoregistry.GlobalTypes.FindExtensionByNumber(message, field); err == nil {
+		return xt, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := extensionNumber{message: message, number: field}
+	xt, ok := t.extensionNumbers[key]
+	if !ok {
+		if xd, err := t.msrc.Extension(message, field); err == nil {
+			xt = t.addExtension(xd)
+		}
+
+		t.extensionNumbers[key] = xt
+	}
+
+	if xt == nil {
+		return nil, protoregistry.NotFound
+	}
+
+	return xt, nil
+}
+
+// addExtension caches a type for xd, and returns it. t.mu must be held.
+func (t *typeResolver) addExtension(xd protoreflect.FieldDescriptor) protoreflect.ExtensionType {
+	if xt, ok := t.extensions[xd.FullName()]; ok {
+		return xt
+	}
+
+	xt := dynamicpb.NewExtensionType(xd)
+	t.extensions[xd.FullName()] = xt
+	t.extensionNumbers[extensionNumber{message: xd.ContainingMessage().FullName(), number: xd.Number()}] = xt
+	return xt
+}
+
+// mayHaveExtensions returns whether messages of type md can have extensions,
+// either themselves or in any message within them. seen holds the messages
+// already checked, which is needed because messages can be recursive.
+func mayHaveExtensions(md protoreflect.MessageDescriptor, seen map[protoreflect.FullName]bool) bool {
+	if seen[md.FullName()] {
+		return false
+	}
+
+	seen[md.FullName()] = true
+	if md.ExtensionRanges().Len() > 0 {
+		return true
+	}
+
+	fields := md.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		if fmd := fields.Get(i).Message(); fmd != nil && mayHaveExtensions(fmd, seen) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseExtensions parses the extensions in msg, which gRPC leaves as unknown
+// fields, because it only knows of the extensions linked into the binary.
+func (args args) parseExtensions(msg proto.Message) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	proto.Reset(msg)
+	return proto.UnmarshalOptions{Resolver: args.resolver}.Unmarshal(b, msg)
+}
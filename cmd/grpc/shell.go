@@ -0,0 +1,582 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const shellHelp = `Commands:
+  ls, ll                    list methods (ll: in long format)
+  describe [SYMBOL...]      describe services, methods, and messages
+  template SYMBOL           output a JSON template for a method's input
+  call METHOD [MESSAGE...]  call METHOD with JSON message(s), or @file
+  set header KEY VALUE      send a header in subsequent calls
+  unset header KEY          stop sending a header
+  headers                   list headers set with "set header"
+  help                      show this message
+  exit                      end the session (or press Ctrl-D)
+
+Press Tab to complete commands, method names, and JSON field names.`
+
+// shellCommands are the commands the shell completes.
+var shellCommands = []string{"call", "describe", "exit", "headers", "help", "ll", "ls", "set", "template", "unset"}
+
+// shell is an interactive session against a single target. Every command
+// reuses the same connection and method source, so there's no need to dial or
+// use reflection again.
+type shell struct {
+	ctx     context.Context
+	cc      *grpc.ClientConn
+	msrc    methodSource
+	args    args
+	methods []protoreflect.MethodDescriptor
+
+	// header is sent with each call, in addition to --header and --rpc-header
+	header metadata.MD
+
+	// term is the terminal the shell reads from, or nil if stdin isn't a
+	// terminal
+	term *term.Terminal
+}
+
+// runShell runs a shell, reading commands from stdin until EOF or "exit". ctx
+// is used for calls.
+func runShell(ctx context.Context, cc *grpc.ClientConn, msrc methodSource, args args) error {
+	if len(args.Symbols) > 0 {
+		return fmt.Errorf("shell: takes no arguments")
+	}
+
+	methods, err := msrc.Methods()
+	if err != nil {
+		return err
+	}
+
+	sh := shell{ctx: ctx, cc: cc, msrc: msrc, args: args, methods: methods, header: metadata.MD{}}
+
+	// without a terminal, e.g. when piping in a script, just read lines
+	readLine := newShellLineReader(os.Stdin)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		sh.term = term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}, args.Target+"> ")
+		sh.term.AutoCompleteCallback = sh.autocomplete
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			_ = sh.term.SetSize(width, height)
+		}
+
+		readLine = sh.readTerminalLine
+	}
+
+	for {
+		line, err := readLine()
+		if err == io.EOF {
+			if sh.term != nil {
+				fmt.Println()
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("shell: %w", err)
+		}
+
+		if exit := sh.exec(line); exit {
+			return nil
+		}
+	}
+}
+
+func newShellLineReader(r io.Reader) func() (string, error) {
+	br := bufio.NewReader(r)
+	return func() (string, error) {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line != "" {
+			// the last line has no trailing newline
+			return line, nil
+		}
+
+		return strings.TrimSuffix(line, "\n"), err
+	}
+}
+
+// readTerminalLine reads a line with line editing, history, and completion.
+// The terminal is only in raw mode while reading, so that commands' output and
+// Ctrl-C (which cancels a call) work as usual.
+func (sh *shell) readTerminalLine() (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+
+	defer term.Restore(fd, state)
+
+	line, err := sh.term.ReadLine()
+	if err == term.ErrPasteIndicator {
+		// pasted lines are reported with an error, but are otherwise normal
+		err = nil
+	}
+
+	return line, err
+}
+
+// exec runs a command, and returns whether the shell should exit.
+func (sh *shell) exec(line string) bool {
+	cmd, rest := cutWord(line)
+
+	args := sh.args
+	var err error
+	switch cmd {
+	case "":
+	case "exit", "quit":
+		return true
+	case "help":
+		fmt.Println(shellHelp)
+	case "ls", "ll":
+		args.Long = cmd == "ll" || rest == "-l"
+		err = listMethods(sh.msrc, args)
+	case "describe":
+		args.Symbols = strings.Fields(rest)
+		err = describeSymbols(sh.msrc, args)
+	case "template":
+		args.Symbols = strings.Fields(rest)
+		err = printTemplate(sh.msrc, args)
+	case "call":
+		err = sh.call(rest)
+	case "set":
+		err = sh.setHeader(rest)
+	case "unset":
+		err = sh.unsetHeader(rest)
+	case "headers":
+		sh.printHeaders()
+	default:
+		err = fmt.Errorf("unknown command %q; enter \"help\" for a list of commands", cmd)
+	}
+
+	if err != nil {
+		if s, ok := rpcStatus(err); ok {
+			printStatusError(sh.args, s, err)
+		} else {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		}
+	}
+
+	return false
+}
+
+// call invokes a method. rest is the method name, optionally followed by input
+// in the same format as --data.
+func (sh *shell) call(rest string) error {
+	name, input := cutWord(rest)
+	if name == "" {
+		return fmt.Errorf("call: missing method")
+	}
+
+	method, err := sh.msrc.Method(protoreflect.FullName(name))
+	if err != nil {
+		return err
+	}
+
+	args := sh.args
+	args.Method = name
+	args.Interactive = false
+	args.Data = nil
+	if input != "" {
+		args.Data = []string{input}
+	} else if method.Input().FullName() != "google.protobuf.Empty" || method.IsStreamingClient() {
+		// unlike on the command line, there's no stdin to fall back to
+		return fmt.Errorf("call: missing input message(s) for %s", name)
+	}
+
+	var pairs []string
+	for k, vs := range sh.header {
+		for _, v := range vs {
+			pairs = append(pairs, k, v)
+		}
+	}
+
+	// Ctrl-C cancels the call, rather than ending the shell
+	ctx, stop := signal.NotifyContext(sh.ctx, os.Interrupt)
+	defer stop()
+
+	if args.MaxTime > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, seconds(args.MaxTime))
+		defer cancel()
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+	return decodeStatusDetails(sh.msrc, invokeMethod(ctx, sh.cc, sh.msrc, args))
+}
+
+func (sh *shell) setHeader(rest string) error {
+	what, rest := cutWord(rest)
+	if what != "header" {
+		return fmt.Errorf("set: usage: set header KEY VALUE")
+	}
+
+	// also accept "key: value", like --header
+	key, value := cutWord(rest)
+	key = strings.TrimSuffix(key, ":")
+	if key == "" {
+		return fmt.Errorf("set: usage: set header KEY VALUE")
+	}
+
+	decoded, err := decodeMetadataHeader(key, value)
+	if err != nil {
+		return fmt.Errorf("set header: decode %q: %w", value, err)
+	}
+
+	sh.header.Set(key, decoded)
+	return nil
+}
+
+func (sh *shell) unsetHeader(rest string) error {
+	what, key := cutWord(rest)
+	if what != "header" || key == "" {
+		return fmt.Errorf("unset: usage: unset header KEY")
+	}
+
+	sh.header.Delete(key)
+	return nil
+}
+
+func (sh *shell) printHeaders() {
+	if len(sh.header) == 0 {
+		fmt.Println("no headers set")
+		return
+	}
+
+	var keys []string
+	for k := range sh.header {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range sh.header[k] {
+			if strings.HasSuffix(k, binHdrSuffix) {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+
+			fmt.Printf("%s: %s\n", k, v)
+		}
+	}
+}
+
+// cutWord splits s into its first whitespace-separated word and the rest of s,
+// with leading and trailing whitespace removed.
+func cutWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, " \t")
+	if i == -1 {
+		return s, ""
+	}
+
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// shellCompletion is a possible completion of a partially-typed word.
+type shellCompletion struct {
+	// text replaces the partial word
+	text string
+
+	// display is how the completion is shown in a list of alternatives
+	display string
+}
+
+// autocomplete is the terminal's AutoCompleteCallback. On Tab, it completes the
+// word before the cursor if there's only one possibility, or else as much of
+// it as all possibilities have in common. If that doesn't add anything, it
+// lists the possibilities instead.
+func (sh *shell) autocomplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+
+	before := line[:pos]
+	partial, completions := sh.completions(before)
+
+	var matches []shellCompletion
+	for _, c := range completions {
+		// JSON keys may be typed without their opening quote
+		if strings.HasPrefix(c.text, partial) || strings.HasPrefix(c.text, `"`+partial) {
+			matches = append(matches, c)
+		}
+	}
+
+	if len(matches) == 0 {
+		return line, pos, true
+	}
+
+	text := matches[0].text
+	if len(matches) == 1 {
+		if !strings.HasSuffix(text, " ") {
+			text += " "
+		}
+	} else {
+		for _, m := range matches[1:] {
+			text = commonPrefix(text, m.text)
+		}
+
+		if len(text) <= len(partial) {
+			var display []string
+			for _, m := range matches {
+				display = append(display, m.display)
+			}
+
+			_, _ = fmt.Fprintln(sh.term, strings.Join(display, "  "))
+			return line, pos, true
+		}
+	}
+
+	start := len(before) - len(partial)
+	return line[:start] + text + line[pos:], start + len(text), true
+}
+
+// completions returns the word being typed at the end of before, and the
+// possible completions for it.
+func (sh *shell) completions(before string) (string, []shellCompletion) {
+	cmd, rest := cutWord(before)
+	if rest == "" && !hasTrailingSpace(before) {
+		return cmd, wordCompletions(shellCommands)
+	}
+
+	switch cmd {
+	case "describe", "template":
+		return lastWord(before), wordCompletions(symbolNames(sh.methods))
+	case "set", "unset":
+		if !strings.ContainsAny(rest, " \t") && !hasTrailingSpace(before) {
+			return rest, wordCompletions([]string{"header"})
+		}
+	case "call":
+		name, input := cutWord(rest)
+		if input == "" && !hasTrailingSpace(before) {
+			var names []string
+			for _, m := range sh.methods {
+				names = append(names, string(m.FullName()))
+			}
+
+			return name, wordCompletions(names)
+		}
+
+		method, err := sh.msrc.Method(protoreflect.FullName(name))
+		if err != nil {
+			return "", nil
+		}
+
+		md, partial, ok := jsonKeyContext(method.Input(), input)
+		if !ok {
+			return "", nil
+		}
+
+		return partial, sh.fieldCompletions(md)
+	}
+
+	return "", nil
+}
+
+func (sh *shell) fieldCompletions(md protoreflect.MessageDescriptor) []shellCompletion {
+	t := templateBuilder{protoNames: sh.args.UseProtoNames}
+
+	var out []shellCompletion
+	fields := md.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		name := t.fieldName(fields.Get(i))
+		out = append(out, shellCompletion{text: fmt.Sprintf("%q: ", name), display: name})
+	}
+
+	return out
+}
+
+func wordCompletions(words []string) []shellCompletion {
+	var out []shellCompletion
+	for _, w := range words {
+		out = append(out, shellCompletion{text: w, display: w})
+	}
+
+	return out
+}
+
+func hasTrailingSpace(s string) bool {
+	return strings.HasSuffix(s, " ") || strings.HasSuffix(s, "\t")
+}
+
+func lastWord(s string) string {
+	return s[strings.LastIndexAny(s, " \t")+1:]
+}
+
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+
+	return a[:i]
+}
+
+type jsonFrameKind int
+
+const (
+	jsonObject jsonFrameKind = iota
+	jsonMap
+	jsonArray
+)
+
+// jsonFrame is a JSON object or array that's been opened, but not closed.
+type jsonFrame struct {
+	kind jsonFrameKind
+
+	// msg is the message a jsonObject is for, or nil if unknown
+	msg protoreflect.MessageDescriptor
+
+	// field is the field whose elements (for a jsonArray) or values (for a
+	// jsonMap) the frame contains, or nil if unknown
+	field protoreflect.FieldDescriptor
+}
+
+// child returns the frame opened by open ('{' or '[') inside of f, where key is
+// the most recent object key.
+func (f jsonFrame) child(key string, open byte) jsonFrame {
+	kind := jsonObject
+	if open == '[' {
+		kind = jsonArray
+	}
+
+	fd := f.field
+	if f.kind == jsonObject {
+		if f.msg == nil {
+			return jsonFrame{kind: kind}
+		}
+
+		fd = jsonField(f.msg, key)
+		if fd == nil {
+			return jsonFrame{kind: kind}
+		}
+
+		switch {
+		case fd.IsMap() && open == '{':
+			return jsonFrame{kind: jsonMap, field: fd.MapValue()}
+		case fd.IsList() && open == '[':
+			return jsonFrame{kind: jsonArray, field: fd}
+		}
+	}
+
+	// well-known types have special JSON representations, so their fields
+	// aren't object keys
+	if fd != nil && open == '{' && fd.Message() != nil && fd.Message().FullName().Parent() != "google.protobuf" {
+		return jsonFrame{kind: jsonObject, msg: fd.Message()}
+	}
+
+	return jsonFrame{kind: kind}
+}
+
+// jsonField returns the field of md with the given JSON or .proto name, or nil.
+func jsonField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByJSONName(name); fd != nil {
+		return fd
+	}
+
+	return md.Fields().ByTextName(name)
+}
+
+// jsonKeyContext determines whether s, the beginning of JSON input for md,
+// ends partway through an object key. If so, it returns the message that
+// object is for, and the partial key, including its opening quote if any.
+func jsonKeyContext(md protoreflect.MessageDescriptor, s string) (protoreflect.MessageDescriptor, string, bool) {
+	var stack []jsonFrame
+	var key string
+	expectKey := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			end := jsonStringEnd(s, i)
+			if end == -1 {
+				if expectKey && len(stack) > 0 {
+					top := stack[len(stack)-1]
+					return top.msg, s[i:], top.kind == jsonObject && top.msg != nil
+				}
+
+				return nil, "", false
+			}
+
+			if expectKey {
+				key = s[i+1 : end]
+			}
+
+			i = end
+		case ':':
+			expectKey = false
+		case ',':
+			expectKey = len(stack) > 0 && stack[len(stack)-1].kind != jsonArray
+		case '{', '[':
+			frame := jsonFrame{kind: jsonObject, msg: md}
+			if len(stack) > 0 {
+				frame = stack[len(stack)-1].child(key, c)
+			} else if c == '[' {
+				// e.g. --json-array input
+				frame = jsonFrame{kind: jsonArray}
+			}
+
+			stack = append(stack, frame)
+			expectKey = c == '{'
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+			if len(stack) == 0 {
+				// a new top-level message may start next
+				key = ""
+			}
+
+			expectKey = false
+		case ' ', '\t', '\n', '\r':
+		default:
+			// an unquoted key, which is invalid JSON, but can be completed
+			rest := s[i:]
+			if expectKey && len(stack) > 0 && !strings.ContainsAny(rest, " \t\"{}[]:,") {
+				top := stack[len(stack)-1]
+				return top.msg, rest, top.kind == jsonObject && top.msg != nil
+			}
+		}
+	}
+
+	if expectKey && len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return top.msg, "", top.kind == jsonObject && top.msg != nil
+	}
+
+	return nil, "", false
+}
+
+// jsonStringEnd returns the index of the quote ending the JSON string starting
+// at s[start], or -1 if the string isn't terminated.
+func jsonStringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// statusExitCodeBase is added to gRPC status codes to get exit codes. 64 is
+// the first exit code not conventionally used for other purposes (see
+// sysexits.h), and leaves room for all current gRPC status codes below 126.
+const statusExitCodeBase = 64
+
+func statusExitCode(code codes.Code) int {
+	return statusExitCodeBase + int(code)
+}
+
+// rpcStatus returns the gRPC status that err wraps, if any.
+func rpcStatus(err error) (*status.Status, bool) {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus(), true
+	}
+
+	return nil, false
+}
+
+type statusErrorJSON struct {
+	Code    codes.Code        `json:"code"`
+	Name    string            `json:"name"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// detailedStatusError is an RPC error whose status details have already been
+// decoded to JSON. Decoding a detail may require looking up its type in the
+// methodSource, which is closed by the time the error is printed.
+type detailedStatusError struct {
+	error
+	details []json.RawMessage
+}
+
+func (e detailedStatusError) Unwrap() error {
+	return e.error
+}
+
+// decodeStatusDetails returns err with its status details, if any, decoded
+// using types from msrc.
+func decodeStatusDetails(msrc methodSource, err error) error {
+	s, ok := rpcStatus(err)
+	if !ok || len(s.Proto().Details) == 0 {
+		return err
+	}
+
+	return detailedStatusError{error: err, details: marshalStatusDetails(newTypeResolver(msrc), s)}
+}
+
+// marshalStatusDetails converts the details of s to JSON, resolving their types
+// with resolver.
+func marshalStatusDetails(resolver protojsonResolver, s *status.Status) []json.RawMessage {
+	var out []json.RawMessage
+	for _, d := range s.Proto().Details {
+		b, err := protojson.MarshalOptions{Resolver: resolver}.Marshal(d)
+		if err == nil {
+			// protojson deliberately makes its whitespace unstable
+			var buf bytes.Buffer
+			_ = json.Compact(&buf, b)
+			b = buf.Bytes()
+		} else {
+			// we don't know the detail's type, so output it the way protojson
+			// would if it did, except with the raw bytes as its value
+			b, _ = json.Marshal(map[string]string{
+				"@type": d.TypeUrl,
+				"value": base64.StdEncoding.EncodeToString(d.Value),
+			})
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
+
+type protojsonResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// printStatusError prints s, the status of the RPC error err, to stderr.
+func printStatusError(args args, s *status.Status, err error) {
+	var details []json.RawMessage
+	var detailedErr detailedStatusError
+	if errors.As(err, &detailedErr) {
+		details = detailedErr.details
+	} else {
+		details = marshalStatusDetails(protoregistry.GlobalTypes, s)
+	}
+
+	if args.ErrorFormat != errorFormatJSON {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], err)
+		for _, d := range details {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: error detail: %s\n", os.Args[0], d)
+		}
+
+		return
+	}
+
+	out := statusErrorJSON{Code: s.Code(), Name: s.Code().String(), Message: s.Message(), Details: details}
+	b, _ := json.Marshal(out)
+	_, _ = fmt.Fprintln(os.Stderr, string(b))
+}
@@ -4,7 +4,14 @@ import "regexp"
 
 var targetPortShorthandRegexp = regexp.MustCompile(`^:(\d+)$`)
 
-func parseTarget(s string) (string, bool) {
+// parseTarget resolves aliases and shorthands in s, and returns the resulting
+// target, and whether it came from a localhost shorthand. aliases are from the
+// config file, and may themselves be shorthands.
+func parseTarget(s string, aliases map[string]string) (string, bool) {
+	if target, ok := aliases[s]; ok {
+		s = target
+	}
+
 	if s == ":" {
 		return "localhost:50051", true
 	}
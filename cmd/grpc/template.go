@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func printTemplate(msrc methodSource, args args) error {
+	if len(args.Symbols) != 1 {
+		return fmt.Errorf("template: must be given exactly one method or message name")
+	}
+
+	d, err := msrc.Descriptor(protoreflect.FullName(args.Symbols[0]))
+	if err != nil {
+		return err
+	}
+
+	var md protoreflect.MessageDescriptor
+	switch d := d.(type) {
+	case protoreflect.MethodDescriptor:
+		md = d.Input()
+	case protoreflect.MessageDescriptor:
+		md = d
+	default:
+		return fmt.Errorf("template: %s is not a method or message", d.FullName())
+	}
+
+	t := templateBuilder{path: map[protoreflect.FullName]bool{}, protoNames: args.UseProtoNames}
+	v := t.message(md)
+
+	var b strings.Builder
+	writeTemplateJSON(&b, v, 0)
+	fmt.Println(b.String())
+
+	// JSON has no comments, so explain oneofs out-of-band
+	for _, od := range t.oneofs {
+		var names []string
+		fields := od.Fields()
+		for i, l := 0, fields.Len(); i < l; i++ {
+			names = append(names, fmt.Sprintf("%q", t.fieldName(fields.Get(i))))
+		}
+
+		_, _ = fmt.Fprintf(os.Stderr, "note: %s are alternatives of oneof %s; keep only one of them\n", strings.Join(names, ", "), od.FullName())
+	}
+
+	return nil
+}
+
+// templateObject is a JSON object that preserves the order of its keys, so that
+// templates list fields in declaration order.
+type templateObject []templateField
+
+type templateField struct {
+	key   string
+	value interface{}
+}
+
+type templateBuilder struct {
+	// path is the set of messages currently being built, used to detect cycles
+	path map[protoreflect.FullName]bool
+
+	// oneofs are the non-synthetic oneofs encountered, in order
+	oneofs []protoreflect.OneofDescriptor
+
+	// protoNames is whether to use .proto field names instead of JSON names
+	protoNames bool
+}
+
+func (t *templateBuilder) fieldName(fd protoreflect.FieldDescriptor) string {
+	if t.protoNames {
+		// this is the name protojson uses for UseProtoNames
+		return fd.TextName()
+	}
+
+	return fd.JSONName()
+}
+
+func (t *templateBuilder) message(md protoreflect.MessageDescriptor) interface{} {
+	if v, ok := wellKnownTemplate(md); ok {
+		return v
+	}
+
+	// a message that (indirectly) contains itself would recurse forever, so
+	// stop at the first repetition with an empty message
+	if t.path[md.FullName()] {
+		return templateObject{}
+	}
+
+	t.path[md.FullName()] = true
+	defer delete(t.path, md.FullName())
+
+	obj := templateObject{}
+	fields := md.Fields()
+	for i, l := 0, fields.Len(); i < l; i++ {
+		fd := fields.Get(i)
+		if od := fd.ContainingOneof(); od != nil && !od.IsSynthetic() && od.Fields().Get(0) == fd {
+			t.oneofs = append(t.oneofs, od)
+		}
+
+		obj = append(obj, templateField{key: t.fieldName(fd), value: t.field(fd)})
+	}
+
+	return obj
+}
+
+func (t *templateBuilder) field(fd protoreflect.FieldDescriptor) interface{} {
+	switch {
+	case fd.IsMap():
+		// JSON object keys are always strings, even for non-string map keys
+		key := fmt.Sprint(t.singular(fd.MapKey()))
+		return templateObject{{key: key, value: t.singular(fd.MapValue())}}
+	case fd.IsList():
+		return []interface{}{t.singular(fd)}
+	default:
+		return t.singular(fd)
+	}
+}
+
+// singular returns a placeholder value for fd, ignoring whether fd is
+// repeated. Placeholders are zero values, in the form protojson expects them.
+func (t *templateBuilder) singular(fd protoreflect.FieldDescriptor) interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return false
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return 0
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// protojson encodes 64-bit integers as strings
+		return "0"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return ""
+	case protoreflect.EnumKind:
+		if fd.Enum().FullName() == "google.protobuf.NullValue" {
+			return nil
+		}
+
+		return string(fd.Enum().Values().Get(0).Name())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return t.message(fd.Message())
+	default:
+		return nil
+	}
+}
+
+// wellKnownTemplate returns placeholders for the well-known types that
+// protojson gives special JSON representations.
+func wellKnownTemplate(md protoreflect.MessageDescriptor) (interface{}, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Any":
+		return templateObject{{key: "@type", value: ""}}, true
+	case "google.protobuf.Timestamp":
+		return "1970-01-01T00:00:00Z", true
+	case "google.protobuf.Duration":
+		return "0s", true
+	case "google.protobuf.FieldMask":
+		return "", true
+	case "google.protobuf.Struct":
+		return templateObject{}, true
+	case "google.protobuf.ListValue":
+		return []interface{}{}, true
+	case "google.protobuf.Value":
+		return nil, true
+	case "google.protobuf.BoolValue":
+		return false, true
+	case "google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.FloatValue", "google.protobuf.DoubleValue":
+		return 0, true
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return "0", true
+	case "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return "", true
+	default:
+		return nil, false
+	}
+}
+
+// writeTemplateJSON writes v as indented JSON. It exists instead of
+// json.MarshalIndent because templateObject must preserve key order.
+func writeTemplateJSON(b *strings.Builder, v interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+	switch v := v.(type) {
+	case templateObject:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+
+		b.WriteString("{\n")
+		for i, f := range v {
+			key, _ := json.Marshal(f.key)
+			b.WriteString(indent + "  " + string(key) + ": ")
+			writeTemplateJSON(b, f.value, depth+1)
+			if i < len(v)-1 {
+				b.WriteString(",")
+			}
+
+			b.WriteString("\n")
+		}
+
+		b.WriteString(indent + "}")
+	case []interface{}:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return
+		}
+
+		b.WriteString("[\n")
+		for i, e := range v {
+			b.WriteString(indent + "  ")
+			writeTemplateJSON(b, e, depth+1)
+			if i < len(v)-1 {
+				b.WriteString(",")
+			}
+
+			b.WriteString("\n")
+		}
+
+		b.WriteString(indent + "]")
+	default:
+		s, _ := json.Marshal(v)
+		b.Write(s)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// templateVarsEncodings are the input encodings --template-vars works with;
+// binary input isn't made of lines of text.
+var templateVarsEncodings = []string{encodingJSON, encodingYAML, encodingText}
+
+// templateEnvVar matches "${NAME}" references to environment variables.
+var templateEnvVar = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// templateFuncs are the functions available in "{{...}}" expressions.
+var templateFuncs = template.FuncMap{
+	"uuid":    templateUUID,
+	"now":     templateNow,
+	"randInt": templateRandInt,
+	"file":    templateFile,
+}
+
+// expandTemplateVars replaces environment variable references and template
+// expressions in s with their values.
+func expandTemplateVars(s string) (string, error) {
+	// most input has no templates, so don't bother parsing it
+	if !strings.Contains(s, "{{") {
+		return expandEnvVars(s)
+	}
+
+	t, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", templateError(err)
+	}
+
+	// environment variables are substituted into the parsed template's text,
+	// so that their values are inserted as-is, rather than being evaluated as
+	// templates themselves
+	for _, t := range t.Templates() {
+		if err := expandNodeEnvVars(t.Tree.Root); err != nil {
+			return "", err
+		}
+	}
+
+	var b strings.Builder
+	if err := t.Execute(&b, nil); err != nil {
+		return "", templateError(err)
+	}
+
+	return b.String(), nil
+}
+
+// expandEnvVars replaces environment variable references in s with their
+// values.
+func expandEnvVars(s string) (string, error) {
+	var envErr error
+	s = templateEnvVar.ReplaceAllStringFunc(s, func(ref string) string {
+		name := templateEnvVar.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && envErr == nil {
+			envErr = fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return value
+	})
+
+	return s, envErr
+}
+
+// expandNodeEnvVars replaces environment variable references in the text of
+// node, and of the nodes within it.
+func expandNodeEnvVars(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+
+		for _, child := range n.Nodes {
+			if err := expandNodeEnvVars(child); err != nil {
+				return err
+			}
+		}
+	case *parse.TextNode:
+		text, err := expandEnvVars(string(n.Text))
+		if err != nil {
+			return err
+		}
+
+		n.Text = []byte(text)
+	case *parse.IfNode:
+		return expandBranchEnvVars(&n.BranchNode)
+	case *parse.RangeNode:
+		return expandBranchEnvVars(&n.BranchNode)
+	case *parse.WithNode:
+		return expandBranchEnvVars(&n.BranchNode)
+	}
+
+	return nil
+}
+
+func expandBranchEnvVars(n *parse.BranchNode) error {
+	if err := expandNodeEnvVars(n.List); err != nil {
+		return err
+	}
+
+	return expandNodeEnvVars(n.ElseList)
+}
+
+// templateErrorPrefix matches the start of text/template's errors, which names
+// the template and a position in it; our templates are unnamed single lines.
+var templateErrorPrefix = regexp.MustCompile(`^template: :\d+(:\d+)?: (executing "" at )?`)
+
+// templateError makes err, from text/template, more readable.
+func templateError(err error) error {
+	// errors from template functions are already descriptive
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		if inner := errors.Unwrap(execErr.Err); inner != nil {
+			return inner
+		}
+	}
+
+	return errors.New(templateErrorPrefix.ReplaceAllString(err.Error(), ""))
+}
+
+// templateReader expands templates in the lines read from r. Each line is
+// expanded separately, so templates can't span lines, but input can be
+// streamed.
+type templateReader struct {
+	r    *bufio.Reader
+	buf  bytes.Buffer
+	line int
+	err  error
+}
+
+func newTemplateReader(r io.Reader) *templateReader {
+	return &templateReader{r: bufio.NewReader(r)}
+}
+
+func (r *templateReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		line, err := r.r.ReadString('\n')
+		r.err = err
+		if line == "" {
+			continue
+		}
+
+		r.line++
+		expanded, err := expandTemplateVars(line)
+		if err != nil {
+			r.err = fmt.Errorf("--template-vars: line %d: %w", r.line, err)
+			return 0, r.err
+		}
+
+		r.buf.WriteString(expanded)
+	}
+
+	return r.buf.Read(p)
+}
+
+// expandHeaderTemplateVars expands templates in each of headers.
+func expandHeaderTemplateVars(headers []string) ([]string, error) {
+	out := make([]string, len(headers))
+	for i, h := range headers {
+		expanded, err := expandTemplateVars(h)
+		if err != nil {
+			return nil, fmt.Errorf("--template-vars: %q: %w", h, err)
+		}
+
+		out[i] = expanded
+	}
+
+	return out, nil
+}
+
+// templateUUID returns a random (version 4) UUID.
+func templateUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// templateNow returns the current time, in the format protojson expects for
+// google.protobuf.Timestamp.
+func templateNow() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// templateRandInt returns a random integer from min to max, inclusive.
+func templateRandInt(min, max int64) (int64, error) {
+	if max < min {
+		return 0, fmt.Errorf("randInt: max (%d) is less than min (%d)", max, min)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(0).Add(big.NewInt(max-min), big.NewInt(1)))
+	if err != nil {
+		return 0, err
+	}
+
+	return min + n.Int64(), nil
+}
+
+// templateFile returns the contents of a file, without trailing newlines, like
+// shell command substitution.
+func templateFile(name string) (string, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("file: %w", err)
+	}
+
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// verboseLogger writes curl-style verbose output: lines starting with "*" are
+// informational, ">" are sent to the server, and "<" are received from it.
+type verboseLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *verboseLogger) printf(prefix, format string, a ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, _ = fmt.Fprintf(l.w, prefix+" "+format+"\n", a...)
+}
+
+func (l *verboseLogger) metadata(prefix string, md metadata.MD) {
+	var keys []string
+	for k := range md {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range md[k] {
+			if strings.HasSuffix(k, "-bin") {
+				v = fmt.Sprintf("[%d bytes of binary data]", len(v))
+			}
+
+			l.printf(prefix, "%s: %s", k, v)
+		}
+	}
+}
+
+// verboseStatsHandler logs the events of each RPC.
+type verboseStatsHandler struct {
+	log *verboseLogger
+}
+
+type verboseRPCKey struct{}
+
+// verboseRPC is the state of an RPC being logged.
+type verboseRPC struct {
+	trailer metadata.MD
+}
+
+func (h verboseStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, verboseRPCKey{}, &verboseRPC{})
+}
+
+func (h verboseStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	rpc := ctx.Value(verboseRPCKey{}).(*verboseRPC)
+	switch s := s.(type) {
+	case *stats.OutHeader:
+		h.log.printf(">", "POST %s", s.FullMethod)
+		h.log.metadata(">", s.Header)
+	case *stats.OutPayload:
+		h.log.printf(">", "[message: %d bytes]", s.Length)
+	case *stats.InHeader:
+		h.log.metadata("<", s.Header)
+	case *stats.InPayload:
+		h.log.printf("<", "[message: %d bytes]", s.Length)
+	case *stats.InTrailer:
+		// grpc-go can report trailers before the last message, so wait until
+		// the end of the RPC to log them
+		rpc.trailer = s.Trailer
+	case *stats.End:
+		if rpc.trailer != nil {
+			h.log.printf("<", "[trailers]")
+			h.log.metadata("<", rpc.trailer)
+		}
+
+		st := status.Convert(s.Error)
+		h.log.printf("*", "RPC ended with status %v after %v", st.Code(), s.EndTime.Sub(s.BeginTime))
+	}
+}
+
+func (h verboseStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h verboseStatsHandler) HandleConn(context.Context, stats.ConnStats) {
+	// connections are logged by verboseCreds instead, which knows more
+}
+
+// verboseCreds wraps transport credentials to log each connection, and the
+// details of its TLS handshake, if any.
+type verboseCreds struct {
+	credentials.TransportCredentials
+	log *verboseLogger
+}
+
+func (c verboseCreds) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c.log.printf("*", "connected to %v (from %v)", rawConn.RemoteAddr(), rawConn.LocalAddr())
+
+	conn, authInfo, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		c.log.printf("*", "handshake with %s failed: %v", authority, err)
+		return nil, nil, err
+	}
+
+	if tlsInfo, ok := authInfo.(credentials.TLSInfo); ok {
+		c.logTLS(tlsInfo.State)
+	}
+
+	return conn, authInfo, nil
+}
+
+func (c verboseCreds) logTLS(state tls.ConnectionState) {
+	c.log.printf("*", "TLS handshake complete: %s, cipher %s, ALPN %q", tls.VersionName(state.Version), tls.CipherSuiteName(state.CipherSuite), state.NegotiatedProtocol)
+
+	// prefer the chain that was actually verified, if we verified one
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+
+	for i, cert := range chain {
+		c.log.printf("*", "server certificate %d:", i)
+		logCert(c.log, cert)
+	}
+}
+
+func (c verboseCreds) Clone() credentials.TransportCredentials {
+	return verboseCreds{TransportCredentials: c.TransportCredentials.Clone(), log: c.log}
+}
+
+func logCert(log *verboseLogger, cert *x509.Certificate) {
+	log.printf("*", "  subject: %s", cert.Subject)
+	log.printf("*", "  issuer: %s", cert.Issuer)
+	log.printf("*", "  valid: %s to %s", cert.NotBefore.UTC().Format("2006-01-02"), cert.NotAfter.UTC().Format("2006-01-02"))
+	if len(cert.DNSNames) > 0 {
+		log.printf("*", "  DNS names: %s", strings.Join(cert.DNSNames, ", "))
+	}
+}
+
+// logConnState logs changes to the state of cc, until ctx is done.
+func logConnState(ctx context.Context, log *verboseLogger, cc *grpc.ClientConn) {
+	go func() {
+		state := cc.GetState()
+		for {
+			log.printf("*", "connection state: %v", state)
+			if !cc.WaitForStateChange(ctx, state) {
+				return
+			}
+
+			state = cc.GetState()
+		}
+	}()
+}
+
+// logCredentials logs which credentials dial will use, and why.
+func logCredentials(log *verboseLogger, args args, isShorthand bool, tlsConfig *tls.Config) {
+	switch {
+	case isShorthand:
+		log.printf("*", "not using TLS, because %q is a localhost alias", args.Target)
+		return
+	case args.Insecure:
+		log.printf("*", "not using TLS, because of --insecure")
+		return
+	}
+
+	serverName := tlsConfig.ServerName
+	if serverName == "" {
+		serverName = "(from target)"
+	}
+
+	rootCAs := "system cert pool"
+	if len(args.ServerRootCA) > 0 {
+		rootCAs = strings.Join(args.ServerRootCA, ", ")
+	}
+
+	log.printf("*", "using TLS, server name: %s, root CAs: %s", serverName, rootCAs)
+	if args.InsecureSkipServerVerify {
+		log.printf("*", "not verifying server certificate, because of --insecure-skip-server-verify")
+	}
+
+	for _, cert := range args.ClientCert {
+		log.printf("*", "using client certificate: %s", cert)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlDecoder decodes a stream of YAML documents, separated by "---", as
+// messages.
+//
+// Each document is converted to JSON and then decoded with protojson, so that
+// YAML input follows exactly the same rules (field names, well-known types,
+// etc.) as JSON input.
+type yamlDecoder struct {
+	dec   *yaml.Decoder
+	opts  protojson.UnmarshalOptions
+	index int
+}
+
+func (d *yamlDecoder) decode(msg proto.Message) error {
+	for {
+		var doc yaml.Node
+		if err := d.dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return io.EOF
+			}
+
+			return fmt.Errorf("message %d: %w", d.index, err)
+		}
+
+		// skip empty documents, e.g. after a trailing "---"; an empty message
+		// can be written as "{}"
+		if len(doc.Content) == 0 || (doc.Content[0].Tag == "!!null" && doc.Content[0].Value == "") {
+			continue
+		}
+
+		index := d.index
+		d.index++
+
+		w := yamlJSONWriter{line: 1}
+		if err := w.write(doc.Content[0]); err != nil {
+			return fmt.Errorf("message %d: %w", index, err)
+		}
+
+		if err := d.opts.Unmarshal(w.buf.Bytes(), msg); err != nil {
+			return fmt.Errorf("message %d: %s", index, yamlErrorPosition.ReplaceAllString(err.Error(), "(line $1)"))
+		}
+
+		return nil
+	}
+}
+
+// yamlErrorPosition matches the positions protojson puts in its errors. Only
+// the line number is meaningful for YAML input; see yamlJSONWriter.
+var yamlErrorPosition = regexp.MustCompile(`\(line (\d+):\d+\)`)
+
+// yamlJSONWriter converts YAML to JSON. It puts each value on the same line
+// of JSON as it was on in the YAML, so that line numbers in protojson errors
+// point to the right line of YAML input.
+type yamlJSONWriter struct {
+	buf  bytes.Buffer
+	line int
+}
+
+func (w *yamlJSONWriter) write(n *yaml.Node) error {
+	w.advance(n.Line)
+
+	switch n.Kind {
+	case yaml.AliasNode:
+		return w.write(n.Alias)
+	case yaml.MappingNode:
+		w.buf.WriteByte('{')
+		for i := 0; i < len(n.Content); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+			}
+
+			// JSON object keys are always strings, even for non-string map
+			// keys, which protojson expects to be quoted
+			w.advance(key.Line)
+			w.writeString(key.Value)
+			w.buf.WriteByte(':')
+			if err := w.write(value); err != nil {
+				return err
+			}
+		}
+
+		w.buf.WriteByte('}')
+	case yaml.SequenceNode:
+		w.buf.WriteByte('[')
+		for i, elem := range n.Content {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+
+			if err := w.write(elem); err != nil {
+				return err
+			}
+		}
+
+		w.buf.WriteByte(']')
+	case yaml.ScalarNode:
+		return w.writeScalar(n)
+	default:
+		return fmt.Errorf("line %d: unsupported YAML node", n.Line)
+	}
+
+	return nil
+}
+
+// advance starts a new line of JSON until the output is on the given line of
+// YAML. Aliases can refer to earlier lines, in which case we can't go back.
+func (w *yamlJSONWriter) advance(line int) {
+	for w.line < line {
+		w.buf.WriteByte('\n')
+		w.line++
+	}
+}
+
+func (w *yamlJSONWriter) writeScalar(n *yaml.Node) error {
+	switch n.ShortTag() {
+	case "!!null":
+		w.buf.WriteString("null")
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+
+		w.buf.WriteString(strconv.FormatBool(b))
+	case "!!int":
+		// YAML allows e.g. hex and octal integers, which JSON doesn't
+		var i int64
+		if err := n.Decode(&i); err == nil {
+			w.buf.WriteString(strconv.FormatInt(i, 10))
+			return nil
+		}
+
+		var u uint64
+		if err := n.Decode(&u); err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+
+		w.buf.WriteString(strconv.FormatUint(u, 10))
+	case "!!float":
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+
+		// protojson represents non-finite numbers as strings
+		switch {
+		case math.IsNaN(f):
+			w.writeString("NaN")
+		case math.IsInf(f, 1):
+			w.writeString("Infinity")
+		case math.IsInf(f, -1):
+			w.writeString("-Infinity")
+		default:
+			w.buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case "!!binary":
+		// protojson expects base64, but doesn't allow the whitespace YAML does
+		w.writeString(strings.Join(strings.Fields(n.Value), ""))
+	default:
+		// strings, as well as e.g. timestamps, which protojson expects as
+		// strings anyway
+		w.writeString(n.Value)
+	}
+
+	return nil
+}
+
+func (w *yamlJSONWriter) writeString(s string) {
+	b, _ := json.Marshal(s)
+	w.buf.Write(b)
+}
@@ -1,12 +1,22 @@
 module github.com/grpcrud/grpcake
 
-go 1.16
+go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/bufbuild/protocompile v0.14.1
 	github.com/ucarion/cli v0.2.0
-	golang.org/x/sync v0.0.0-20220601150217-0de741cfad7f // indirect
-	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467
-	google.golang.org/grpc v1.43.0
+	golang.org/x/sync v0.8.0
+	golang.org/x/term v0.18.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237
+	google.golang.org/grpc v1.64.0
 	google.golang.org/grpc/cmd/protoc-gen-go-grpc v1.2.0
-	google.golang.org/protobuf v1.27.1
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
 )
@@ -29,6 +29,9 @@ type EchoClient interface {
 	ServerStreamEcho(ctx context.Context, in *CountMessage, opts ...grpc.CallOption) (Echo_ServerStreamEchoClient, error)
 	BidiStreamEcho(ctx context.Context, opts ...grpc.CallOption) (Echo_BidiStreamEchoClient, error)
 	EchoMetadata(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*MetadataMessage, error)
+	// EchoError always fails with the given status code and message, and with
+	// error details of both standard and custom types.
+	EchoError(ctx context.Context, in *ErrorMessage, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type echoClient struct {
@@ -163,6 +166,15 @@ func (c *echoClient) EchoMetadata(ctx context.Context, in *emptypb.Empty, opts .
 	return out, nil
 }
 
+func (c *echoClient) EchoError(ctx context.Context, in *ErrorMessage, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/echo.Echo/EchoError", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // EchoServer is the server API for Echo service.
 // All implementations must embed UnimplementedEchoServer
 // for forward compatibility
@@ -173,6 +185,9 @@ type EchoServer interface {
 	ServerStreamEcho(*CountMessage, Echo_ServerStreamEchoServer) error
 	BidiStreamEcho(Echo_BidiStreamEchoServer) error
 	EchoMetadata(context.Context, *emptypb.Empty) (*MetadataMessage, error)
+	// EchoError always fails with the given status code and message, and with
+	// error details of both standard and custom types.
+	EchoError(context.Context, *ErrorMessage) (*emptypb.Empty, error)
 	mustEmbedUnimplementedEchoServer()
 }
 
@@ -198,6 +213,9 @@ func (UnimplementedEchoServer) BidiStreamEcho(Echo_BidiStreamEchoServer) error {
 func (UnimplementedEchoServer) EchoMetadata(context.Context, *emptypb.Empty) (*MetadataMessage, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method EchoMetadata not implemented")
 }
+func (UnimplementedEchoServer) EchoError(context.Context, *ErrorMessage) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EchoError not implemented")
+}
 func (UnimplementedEchoServer) mustEmbedUnimplementedEchoServer() {}
 
 // UnsafeEchoServer may be embedded to opt out of forward compatibility for this service.
@@ -338,6 +356,24 @@ func _Echo_EchoMetadata_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Echo_EchoError_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ErrorMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EchoServer).EchoError(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/echo.Echo/EchoError",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EchoServer).EchoError(ctx, req.(*ErrorMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Echo_ServiceDesc is the grpc.ServiceDesc for Echo service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -357,6 +393,10 @@ var Echo_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "EchoMetadata",
 			Handler:    _Echo_EchoMetadata_Handler,
 		},
+		{
+			MethodName: "EchoError",
+			Handler:    _Echo_EchoError_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
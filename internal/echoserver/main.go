@@ -12,11 +12,16 @@ import (
 	"time"
 
 	"github.com/grpcrud/grpcake/internal/echo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -30,6 +35,7 @@ func main() {
 	clientTLS := flag.Bool("client-tls", false, "require client tls auth")
 	clientCACertFile := flag.String("client-ca-cert-file", "internal/echoserver/client-ca.crt", "client CA cert file")
 	reflection_ := flag.Bool("reflection", false, "enable reflection")
+	reflectionVersion := flag.String("reflection-version", "all", "reflection versions to register: all, v1, or v1alpha")
 	flag.Parse()
 
 	var tlsConfig tls.Config
@@ -84,7 +90,16 @@ func main() {
 	echo.RegisterEchoServer(s, server{})
 
 	if *reflection_ {
-		reflection.Register(s)
+		switch *reflectionVersion {
+		case "all":
+			reflection.Register(s)
+		case "v1":
+			reflection.RegisterV1(s)
+		case "v1alpha":
+			grpc_reflection_v1alpha.RegisterServerReflectionServer(s, reflection.NewServer(reflection.ServerOptions{Services: s}))
+		default:
+			panic("unknown reflection version: " + *reflectionVersion)
+		}
 	}
 
 	if err := s.Serve(l); err != nil {
@@ -190,3 +205,23 @@ func (s server) EchoMetadata(ctx context.Context, _ *emptypb.Empty) (*echo.Metad
 
 	return res, nil
 }
+
+func (s server) EchoError(_ context.Context, msg *echo.ErrorMessage) (*emptypb.Empty, error) {
+	code := codes.Code(msg.Code)
+	if code == codes.OK {
+		code = codes.InvalidArgument
+	}
+
+	st, err := status.New(code, msg.Message).WithDetails(
+		&errdetails.ErrorInfo{Reason: "ECHO_ERROR", Domain: "echo", Metadata: map[string]string{"code": code.String()}},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "message", Description: msg.Message}}},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{Subject: "echo", Description: "example quota violation"}}},
+		&echo.ErrorDetail{Message: msg.Message, Hints: []string{"this detail has a custom type"}},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, st.Err()
+}